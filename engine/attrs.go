@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// classAttr renders @class([...]): pairs are class names and conditions,
+// and the names whose condition is true form the class attribute.
+func classAttr(pairs ...interface{}) (template.HTMLAttr, error) {
+	names, err := enabled(pairs)
+	if err != nil {
+		return "", err
+	}
+	return template.HTMLAttr(`class="` + template.HTMLEscapeString(strings.Join(names, " ")) + `"`), nil
+}
+
+// styleAttr renders @style([...]) like classAttr, joining declarations
+// with semicolons.
+func styleAttr(pairs ...interface{}) (template.HTMLAttr, error) {
+	decls, err := enabled(pairs)
+	if err != nil {
+		return "", err
+	}
+	for i, d := range decls {
+		decls[i] = strings.TrimRight(strings.TrimSpace(d), ";")
+	}
+	style := strings.Join(decls, "; ")
+	if style != "" {
+		style += ";"
+	}
+	return template.HTMLAttr(`style="` + template.HTMLEscapeString(style) + `"`), nil
+}
+
+// attrs renders @attr([...]): pairs are attribute names and values, kept
+// in order. As for $attributes, true gives a bare attribute and false and
+// nil leave the attribute out.
+func attrs(pairs ...interface{}) (template.HTMLAttr, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("expected name/value pairs, got %d arguments", len(pairs))
+	}
+	var parts []string
+	for i := 0; i < len(pairs); i += 2 {
+		name := template.HTMLEscapeString(stringify(pairs[i]))
+		switch v := pairs[i+1].(type) {
+		case nil:
+		case bool:
+			if v {
+				parts = append(parts, name)
+			}
+		default:
+			parts = append(parts, name+`="`+template.HTMLEscapeString(stringify(v))+`"`)
+		}
+	}
+	return template.HTMLAttr(strings.Join(parts, " ")), nil
+}
+
+// enabled returns the names of name/condition pairs whose condition is true.
+func enabled(pairs []interface{}) ([]string, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("expected name/condition pairs, got %d arguments", len(pairs))
+	}
+	names := []string{}
+	for i := 0; i < len(pairs); i += 2 {
+		if ok, _ := template.IsTrue(pairs[i+1]); ok {
+			if name := stringify(pairs[i]); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAttributeDirectives(t *testing.T) {
+	data := map[string]interface{}{"active": true, "error": false, "color": `red"`, "plan": "pro", "id": "<x>"}
+	cases := []struct{ src, want string }{
+		{`<p @class(['btn', 'active' => $active, 'err' => $error])>`, `<p class="btn active">`},
+		{`<p @class([])>`, `<p class="">`},
+		{`<p @style(['color: ' ~ $color, 'display: none' => $error])>`, `<p style="color: red&#34;;">`},
+		{`<input @attr(['id' => $id, 'required' => true, 'hidden' => $error])>`, `<input id="&lt;x&gt;" required>`},
+		{`<input type="checkbox" @checked($active) @disabled($error)>`, `<input type="checkbox" checked >`},
+		{`<option @selected($plan == 'pro')>Pro</option>`, `<option selected>Pro</option>`},
+		{`<input @readonly(!$active) @required($active)>`, `<input  required>`},
+		{`mail me@class.io or support@include.io`, `mail me@class.io or support@include.io`},
+	}
+	for _, c := range cases {
+		if got := renderBlade(t, c.src, data); got != c.want {
+			t.Errorf("%s\n got: %s\nwant: %s", c.src, got, c.want)
+		}
+	}
+}
+
+func TestJSONDirectives(t *testing.T) {
+	data := map[string]interface{}{
+		"user": map[string]interface{}{"name": "</script><b>", "id": 1},
+		"n":    3,
+	}
+	out := renderBlade(t, `<script>var u = @json($user); var n = @js($n); var j = @js($user);</script><div data-user="@json($user)"></div>`, data)
+	for _, want := range []string{
+		`var u = {"id":1,"name":"\u003c/script\u003e\u003cb\u003e"};`,
+		`var n = 3;`,
+		`var j = JSON.parse('{\"id\":1,\"name\":\"\\u003c/script\\u003e\\u003cb\\u003e\"}');`,
+		`data-user="{&#34;id&#34;:1,&#34;name&#34;:&#34;\u003c/script\u003e\u003cb\u003e&#34;}"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestAttributeDirectiveErrors(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	for _, src := range []string{`<p @class('btn')>`, `<input @checked()>`} {
+		if _, err := c.CompileString(src, "inline.blade.tpl"); err == nil {
+			t.Errorf("expected a compile error for %s", src)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Authorizer decides the @can, @cannot and @role directives for the user
+// of a request. Register one with BladeEngine.SetAuthorizer; without one,
+// every check is denied. user is never nil: guests are denied before the
+// Authorizer is asked.
+type Authorizer interface {
+	Can(user interface{}, ability string, args ...interface{}) bool
+	HasRole(user interface{}, role string) bool
+}
+
+// AuthContext carries the authenticated user of a request to the
+// authorization directives. Templates receive it under the "_auth" key,
+// set by WithFiberContext after AuthMiddleware or by WithAuth.
+type AuthContext struct {
+	User interface{}
+}
+
+// authLocalsKey is the Fiber Locals key AuthMiddleware stores the
+// AuthContext under.
+const authLocalsKey = "blade.auth"
+
+// AuthMiddleware returns Fiber middleware that reads the authenticated user
+// from c.Locals(userKey) for the authorization directives. It must run
+// after the middleware that authenticates the request and sets the user.
+func AuthMiddleware(userKey string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(authLocalsKey, &AuthContext{User: c.Locals(userKey)})
+		return c.Next()
+	}
+}
+
+// WithAuth returns data with user added as the authenticated user, for
+// rendering outside Fiber. It accepts the same data shapes as
+// WithFiberContext.
+func WithAuth(data interface{}, user interface{}) map[string]interface{} {
+	return withEntry(data, "_auth", &AuthContext{User: user})
+}
+
+// SetAuthorizer sets the Authorizer used by the authorization directives.
+func (c *Compiler) SetAuthorizer(a Authorizer) {
+	c.extMu.Lock()
+	defer c.extMu.Unlock()
+	c.authorizer = a
+}
+
+// authUser returns the authenticated user found in the root data, or nil
+// for a guest.
+func authUser(root interface{}) interface{} {
+	m, _ := root.(map[string]interface{})
+	ctx, _ := m["_auth"].(*AuthContext)
+	if ctx == nil || ctx.User == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(ctx.User); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	return ctx.User
+}
+
+// authCheck reports whether the request has an authenticated user, for
+// @auth and @guest.
+func authCheck(root interface{}) bool {
+	return authUser(root) != nil
+}
+
+// authCan asks the Authorizer whether the user may perform ability, for
+// @can and @cannot. The remaining arguments, such as the model, are
+// passed on.
+func (c *Compiler) authCan(root interface{}, ability string, args ...interface{}) bool {
+	user := authUser(root)
+	c.extMu.RLock()
+	a := c.authorizer
+	c.extMu.RUnlock()
+	return user != nil && a != nil && a.Can(user, ability, args...)
+}
+
+// authRole asks the Authorizer whether the user has role, for @role.
+func (c *Compiler) authRole(root interface{}, role string) bool {
+	user := authUser(root)
+	c.extMu.RLock()
+	a := c.authorizer
+	c.extMu.RUnlock()
+	return user != nil && a != nil && a.HasRole(user, role)
+}
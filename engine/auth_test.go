@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type testUser struct {
+	Name  string
+	Roles []string
+}
+
+// ownerAuthorizer lets users edit posts they wrote.
+type ownerAuthorizer struct{}
+
+func (ownerAuthorizer) Can(user interface{}, ability string, args ...interface{}) bool {
+	u := user.(*testUser)
+	if ability != "edit" || len(args) != 1 {
+		return false
+	}
+	post, _ := args[0].(map[string]interface{})
+	return post["author"] == u.Name
+}
+
+func (ownerAuthorizer) HasRole(user interface{}, role string) bool {
+	for _, r := range user.(*testUser).Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+const authPage = `@auth<b>hi</b>@else<b>login</b>@endauth
+@guest<i>guest</i>@endguest
+@can('edit', $post)<a>edit</a>@elsecan('delete', $post)<a>delete</a>@else<span>read</span>@endcan
+@cannot('edit', $post)<em>locked</em>@endcannot
+@role('admin')<u>admin</u>@elserole('editor')<u>editor</u>@endrole`
+
+func TestAuthorizationDirectives(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "pages/post.blade.tpl", authPage)
+	be := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, Development: true})
+	be.SetAuthorizer(ownerAuthorizer{})
+	post := map[string]interface{}{"author": "al"}
+
+	cases := []struct {
+		user       *testUser
+		want, deny []string
+	}{
+		{&testUser{Name: "al", Roles: []string{"editor"}}, []string{"<b>hi</b>", "<a>edit</a>", "<u>editor</u>"}, []string{"guest", "locked", "read"}},
+		{&testUser{Name: "bo", Roles: []string{"admin"}}, []string{"<b>hi</b>", "<span>read</span>", "<em>locked</em>", "<u>admin</u>"}, []string{"guest", "<a>"}},
+		{nil, []string{"<b>login</b>", "<i>guest</i>", "<span>read</span>", "<em>locked</em>"}, []string{"<u>", "<a>"}},
+	}
+	for _, c := range cases {
+		out, err := be.RenderString("pages/post.blade.tpl", WithAuth(map[string]interface{}{"post": post}, c.user))
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		for _, want := range c.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("user %v: expected %s in output:\n%s", c.user, want, out)
+			}
+		}
+		for _, deny := range c.deny {
+			if strings.Contains(out, deny) {
+				t.Errorf("user %v: unexpected %s in output:\n%s", c.user, deny, out)
+			}
+		}
+	}
+
+	// without an Authorizer every check is denied
+	plain := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, Development: true})
+	out, err := plain.RenderString("pages/post.blade.tpl", WithAuth(map[string]interface{}{"post": post}, &testUser{Name: "al"}))
+	if err != nil || !strings.Contains(out, "<b>hi</b>") || !strings.Contains(out, "<span>read</span>") || strings.Contains(out, "<u>") {
+		t.Fatalf("expected denied checks without an Authorizer, got %v:\n%s", err, out)
+	}
+}
+
+func TestAuthMiddlewareReadsFiberLocals(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "pages/post.blade.tpl", authPage)
+	be := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, Development: true})
+	be.SetAuthorizer(ownerAuthorizer{})
+	adapter := &FiberViewsAdapter{Engine: be}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Query("as") != "" {
+			c.Locals("user", &testUser{Name: c.Query("as"), Roles: []string{"admin"}})
+		}
+		return c.Next()
+	})
+	app.Use(AuthMiddleware("user"))
+	app.Get("/post", func(c *fiber.Ctx) error {
+		return adapter.RenderWithCtx(c, "pages/post.blade.tpl", map[string]interface{}{"post": map[string]interface{}{"author": "al"}})
+	})
+
+	for query, want := range map[string]string{"?as=al": "<a>edit</a>", "": "<i>guest</i>"} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/post"+query, nil), 5000)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(body), want) {
+			t.Errorf("%q: expected %s in body:\n%s", query, want, body)
+		}
+	}
+}
+
+func TestAuthDirectiveErrors(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	for _, src := range []string{`@auth('web') x @endauth`, `@can() x @endcan`} {
+		if _, err := c.CompileString(src, "inline.blade.tpl"); err == nil {
+			t.Errorf("expected a compile error for %s", src)
+		}
+	}
+	for _, name := range []string{"auth", "can", "role"} {
+		if err := c.If(name, func(...interface{}) bool { return true }); err == nil {
+			t.Errorf("expected an error when overriding @%s", name)
+		}
+	}
+}
+
+func TestAuthDirectivesInEmailAddresses(t *testing.T) {
+	out := renderBlade(t, `mail support@auth.io or guests@guest.io`, nil)
+	if out != "mail support@auth.io or guests@guest.io" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -30,6 +31,7 @@ type BladeEngine struct {
 	development      bool    // Development mode (disables cache)
 	mode             string  // "blade" or "go"
 	fs               fsys.FS // optional embedded FS for go mode
+	strict           bool    // see BladeConfig.Strict
 }
 
 // BladeConfig configuration for Blade Engine
@@ -52,6 +54,18 @@ type BladeConfig struct {
 	// compiler-produced compiled files on disk. This is useful when you want to avoid
 	// storing parsed *template.Template objects in process memory.
 	DiskCacheOnly bool
+	// Funcs adds template functions to the built-in helpers, for both Blade
+	// and native Go templates. See also BladeEngine.AddFuncs.
+	Funcs template.FuncMap
+	// Strict makes mistakes fail loudly: a $variable read from the data
+	// must be declared with @props (a compile error otherwise) and a
+	// missing map key is a *RenderError rather than an empty string.
+	Strict bool
+	// CSRFLocalsKey is the Fiber Locals key @csrf reads the token from,
+	// the ContextKey of the csrf middleware; "csrf" when empty.
+	// CSRFFieldName names the hidden input; "_csrf" when empty.
+	CSRFLocalsKey string
+	CSRFFieldName string
 }
 
 // NewBladeEngineWithConfig creates a new Blade Engine with the given configuration
@@ -76,6 +90,12 @@ func NewBladeEngineWithConfig(config BladeConfig) *BladeEngine {
 	compiler := NewCompilerWithOptions(config.TemplatesDir, "blade", fsForCompiler)
 	// Also create a native Go compiler that can parse .gohtml/.html templates using the embedded FS when needed
 	goCompiler := NewCompilerWithOptions(config.TemplatesDir, "go", config.EmbeddedFS)
+	compiler.AddFuncs(config.Funcs)
+	goCompiler.AddFuncs(config.Funcs)
+	compiler.SetStrict(config.Strict)
+	goCompiler.SetStrict(config.Strict)
+	compiler.SetCSRF(config.CSRFLocalsKey, config.CSRFFieldName)
+	goCompiler.SetCSRF(config.CSRFLocalsKey, config.CSRFFieldName)
 
 	autoExts := config.AutoModeExtensions
 	if len(autoExts) == 0 {
@@ -94,6 +114,7 @@ func NewBladeEngineWithConfig(config BladeConfig) *BladeEngine {
 		development:        config.Development,
 		mode:               m,
 		fs:                 config.EmbeddedFS,
+		strict:             config.Strict,
 	}
 	// Validate all templates before starting
 	if err := be.ValidateAllTemplates(); err != nil {
@@ -161,53 +182,96 @@ func NewBladeEngine(templatesDir string) *BladeEngine {
 
 // Render render template với data
 func (b *BladeEngine) Render(w io.Writer, templateName string, data interface{}) error {
-	// In development mode, do not use cache
-	if b.development {
-		return b.renderWithoutCache(w, templateName, data)
+	tmpl, err := b.load(templateName)
+	if err != nil {
+		return err
 	}
+	return b.execute(tmpl, w, templateName, "", data)
+}
 
-	// Use cache if enabled
-	if b.enableCache && b.cacheManager != nil {
-		return b.renderWithCache(w, templateName, data)
-	}
+// ErrFragmentNotFound is returned by RenderFragment for a template without
+// the requested @fragment.
+var ErrFragmentNotFound = errors.New("fragment not found")
 
-	return b.renderWithoutCache(w, templateName, data)
+// RenderFragment renders only the @fragment('name') block of a template,
+// e.g. one table row for an htmx swap. The template is compiled and cached
+// as for Render; data takes the place of the fragment's surroundings, so a
+// fragment inside @foreach($rows as $row) reads $row from data.
+func (b *BladeEngine) RenderFragment(w io.Writer, templateName, fragment string, data interface{}) error {
+	tmpl, err := b.load(templateName)
+	if err != nil {
+		return err
+	}
+	if tmpl.Lookup(fragmentPrefix+fragment) == nil {
+		return fmt.Errorf("%w: %q in %s", ErrFragmentNotFound, fragment, templateName)
+	}
+	return b.execute(tmpl, w, templateName, fragmentPrefix+fragment, data)
 }
 
-// renderWithCache render template using cache
-// Note: we do not write compiled files here anymore.
-// Compiled file cache management is handled by the Compiler.
-func (b *BladeEngine) renderWithCache(w io.Writer, templateName string, data interface{}) error {
+// load returns the parsed template, from the cache when it is enabled and
+// development mode is off.
+func (b *BladeEngine) load(templateName string) (*template.Template, error) {
+	// In development mode, do not use cache
+	if b.development || !b.enableCache || b.cacheManager == nil {
+		templatePath := filepath.Join(b.templatesDir, templateName)
+		fmt.Println("templatePath", templatePath)
+		return b.chooseCompilerFor(templateName).ParseTemplate(templatePath)
+	}
+
 	// Check cache
 	if tmpl, found := b.cacheManager.Get(templateName); found {
-		return tmpl.Execute(w, data)
+		return tmpl, nil
 	}
 
 	// Template not found in cache, compile and cache
 	tmpl, size, err := b.compileAndCacheTemplate(templateName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Add to cache
 	if err := b.cacheManager.Set(templateName, tmpl, size); err != nil {
 		fmt.Printf("Warning: Could not cache template %s: %v\n", templateName, err)
 	}
-
-	return tmpl.Execute(w, data)
+	return tmpl, nil
 }
 
-// renderWithoutCache render template without using cache
-func (b *BladeEngine) renderWithoutCache(w io.Writer, templateName string, data interface{}) error {
-	templatePath := filepath.Join(b.templatesDir, templateName)
-	fmt.Println("templatePath", templatePath)
-	comp := b.chooseCompilerFor(templateName)
-	tmpl, err := comp.ParseTemplate(templatePath)
+// execute runs tmpl, or its template named entry when entry is not empty,
+// and maps execution errors back to the template source as a
+// *RenderError. Templates using @push/@stack are rendered into a buffer
+// first so pushed content can be moved into its stack, or a flush point
+// at a time when streamed, and the @flush markers of templates using
+// @flush are removed.
+func (b *BladeEngine) execute(tmpl *template.Template, w io.Writer, templateName, entry string, data interface{}) error {
+	fw, streaming := w.(*flushWriter)
+	if !streaming && tmpl.Lookup(flushTemplate) != nil {
+		w = &flushWriter{w: w}
+	}
+	out := w
+	var buf bytes.Buffer
+	stacked := tmpl.Lookup(stacksTemplate) != nil
+	if stacked && streaming {
+		fw.stacks = newStackResolver()
+	} else if stacked {
+		out = &buf
+	}
+	var err error
+	if entry == "" {
+		err = tmpl.Execute(out, data)
+	} else {
+		err = tmpl.ExecuteTemplate(out, entry, data)
+	}
 	if err != nil {
+		return newRenderError(templateName, b.compilerFor(templateName).MapError(filepath.Join(b.templatesDir, templateName), err))
+	}
+	if streaming {
+		return fw.finish()
+	}
+	if stacked {
+		_, err := w.Write(resolveStacks(buf.Bytes()))
 		return err
 	}
-
-	return tmpl.Execute(w, data)
+	return nil
 }
 
 // compileAndCacheTemplate compile template and estimate size
@@ -262,6 +326,49 @@ func (b *BladeEngine) ClearCache() {
 	}
 }
 
+// Directive registers a custom Blade directive, e.g. @money($price). fn
+// receives the argument text and returns the template source that replaces
+// the directive at compile time; see Compiler.Directive. Templates cached
+// before the registration are compiled again. It panics if name is invalid
+// or names a built-in directive.
+func (b *BladeEngine) Directive(name string, fn func(args string) string) {
+	if err := b.compiler.Directive(name, fn); err != nil {
+		panic("blade: " + err.Error())
+	}
+	b.ClearCache()
+}
+
+// If registers a custom conditional directive, used as @name(args) ...
+// @else ... @endname or @unlessname(args) ... @endname. fn receives the
+// evaluated arguments at render time. It panics like Directive.
+func (b *BladeEngine) If(name string, fn func(args ...interface{}) bool) {
+	if err := b.compiler.If(name, fn); err != nil {
+		panic("blade: " + err.Error())
+	}
+	b.ClearCache()
+}
+
+// SetAuthorizer registers the Authorizer behind @can, @cannot and @role.
+// The user comes from the request, see AuthMiddleware and WithAuth.
+func (b *BladeEngine) SetAuthorizer(a Authorizer) {
+	b.compiler.SetAuthorizer(a)
+	b.goCompiler.SetAuthorizer(a)
+}
+
+// AddFunc registers a template function, e.g. AddFunc("money", fmt.Sprintf).
+// It panics like template.Funcs if fn is not a suitable function.
+func (b *BladeEngine) AddFunc(name string, fn interface{}) {
+	b.AddFuncs(template.FuncMap{name: fn})
+}
+
+// AddFuncs registers template functions with both compilers. Cached
+// templates are dropped so they are parsed again with the new functions.
+func (b *BladeEngine) AddFuncs(funcs template.FuncMap) {
+	b.compiler.AddFuncs(funcs)
+	b.goCompiler.AddFuncs(funcs)
+	b.ClearCache()
+}
+
 // CacheStats returns cache statistics
 func (b *BladeEngine) CacheStats() map[string]interface{} {
 	if b.cacheManager != nil {
@@ -363,7 +470,10 @@ func (b *BladeEngine) SetDevelopmentMode(development bool) {
 	b.development = development
 	// Recreate compiler to use HybridFS (disk-first, fallback to embedded)
 	hybrid := NewHybridFS(b.templatesDir, b.fs)
-	b.compiler = NewCompilerWithOptions(b.templatesDir, b.mode, hybrid)
+	compiler := NewCompilerWithOptions(b.templatesDir, b.mode, hybrid)
+	compiler.copyExtensions(b.compiler)
+	compiler.SetStrict(b.strict)
+	b.compiler = compiler
 }
 
 // SetMode allows switching between "blade" and "go"
@@ -375,7 +485,10 @@ func (b *BladeEngine) SetMode(mode string) {
 	b.mode = m
 	// recreate compiler with the new mode
 	hybrid := NewHybridFS(b.templatesDir, b.fs)
-	b.compiler = NewCompilerWithOptions(b.templatesDir, b.mode, hybrid)
+	compiler := NewCompilerWithOptions(b.templatesDir, b.mode, hybrid)
+	compiler.copyExtensions(b.compiler)
+	compiler.SetStrict(b.strict)
+	b.compiler = compiler
 }
 
 // IsBladeMode returns true if engine is using Blade syntax
@@ -427,24 +540,32 @@ func (b *BladeEngine) estimateTemplateSize(templatePath string, tmpl *template.T
 // chooseCompilerFor selects the appropriate compiler based on template filename extension
 // and records which compiler was used for debugging/metrics.
 func (b *BladeEngine) chooseCompilerFor(templateName string) *Compiler {
-	// default
-	comp := b.compiler
-	chosen := "blade"
+	comp, chosen := b.selectCompiler(templateName)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastUsedCompiler = chosen
+	b.usageCounts[chosen] = b.usageCounts[chosen] + 1
+	// log selection for runtime debugging
+	log.Printf("BladeEngine: chose %s compiler for %s", chosen, templateName)
+	return comp
+}
+
+// selectCompiler returns the compiler for templateName and its name ("blade" or "go").
+func (b *BladeEngine) selectCompiler(templateName string) (*Compiler, string) {
 	for _, ext := range b.autoModeExtensions {
 		if strings.HasSuffix(templateName, ext) {
 			if b.goCompiler != nil {
-				comp = b.goCompiler
-				chosen = "go"
+				return b.goCompiler, "go"
 			}
 			break
 		}
 	}
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	b.lastUsedCompiler = chosen
-	b.usageCounts[chosen] = b.usageCounts[chosen] + 1
-	// log selection for runtime debugging
-	log.Printf("BladeEngine: chose %s compiler for %s", chosen, templateName)
+	return b.compiler, "blade"
+}
+
+// compilerFor returns the compiler for templateName without recording usage.
+func (b *BladeEngine) compilerFor(templateName string) *Compiler {
+	comp, _ := b.selectCompiler(templateName)
 	return comp
 }
 
@@ -0,0 +1,93 @@
+package blade
+
+// Node is an element of a parsed Blade document.
+type Node interface {
+	Position() Pos
+}
+
+// Document is the root of a parsed template.
+type Document struct {
+	Nodes []Node
+}
+
+// TextNode is literal markup copied to the output.
+type TextNode struct {
+	Pos  Pos
+	Text string
+}
+
+// EchoNode is an escaped {{ expr }} or raw {!! expr !!} output.
+type EchoNode struct {
+	Pos       Pos
+	Expr      string
+	Raw       bool
+	TrimLeft  bool
+	TrimRight bool
+}
+
+// ActionNode is a native html/template action passed through unchanged,
+// e.g. {{ range .items }} or {{ end }}.
+type ActionNode struct {
+	Pos       Pos
+	Text      string
+	TrimLeft  bool
+	TrimRight bool
+}
+
+// DirectiveNode is a standalone directive such as @yield('content').
+type DirectiveNode struct {
+	Pos     Pos
+	Name    string
+	Args    string
+	HasArgs bool
+}
+
+// Clause is an intermediate branch of a block, e.g. @elseif(...) or @else.
+type Clause struct {
+	Pos     Pos
+	Name    string
+	Args    string
+	HasArgs bool
+	Body    []Node
+}
+
+// BlockNode is a directive with a body closed by a matching end directive,
+// e.g. @if(...) ... @elseif(...) ... @else ... @endif.
+type BlockNode struct {
+	Pos     Pos
+	Name    string
+	Args    string
+	HasArgs bool
+	Body    []Node
+	Clauses []*Clause
+	End     string // name of the closing directive (endif, show, ...)
+	EndPos  Pos
+}
+
+// Attr is an attribute of a component tag: name="value", :name="$expr"
+// (Bound) or a bare name.
+type Attr struct {
+	Name     string
+	Value    string
+	Bound    bool
+	HasValue bool
+}
+
+// ComponentNode is a <x-name ...>...</x-name> component tag. Slot tags
+// (<x-slot:name> or <x-slot name="...">) are ComponentNodes with Slot set.
+type ComponentNode struct {
+	Pos         Pos
+	Name        string // e.g. "alert" or "forms.input"
+	Slot        string // slot name for <x-slot> tags
+	Attrs       []Attr
+	Body        []Node
+	SelfClosing bool
+	EndPos      Pos
+}
+
+func (n *TextNode) Position() Pos      { return n.Pos }
+func (n *EchoNode) Position() Pos      { return n.Pos }
+func (n *ActionNode) Position() Pos    { return n.Pos }
+func (n *DirectiveNode) Position() Pos { return n.Pos }
+func (n *BlockNode) Position() Pos     { return n.Pos }
+func (n *ComponentNode) Position() Pos { return n.Pos }
@@ -0,0 +1,408 @@
+package blade
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pos is a location in the template source.
+type Pos struct {
+	Offset int // byte offset, 0-based
+	Line   int // 1-based
+	Col    int // 1-based, counted in runes
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+type TokenType int
+
+const (
+	TokEOF          TokenType = iota
+	TokText                   // literal markup
+	TokEcho                   // {{ expr }}
+	TokRawEcho                // {!! expr !!}
+	TokComment                // {{-- comment --}}
+	TokAction                 // native Go template action, e.g. {{ range .items }}
+	TokDirective              // @name or @name(args)
+	TokComponent              // <x-name attrs> or <x-name attrs />
+	TokComponentEnd           // </x-name>
+)
+
+// Token is a lexical unit of a Blade template.
+type Token struct {
+	Typ       TokenType
+	Val       string // text, expression or directive name
+	Args      string // directive arguments without the outer parentheses
+	HasArgs   bool
+	TrimLeft  bool // {{- marker
+	TrimRight bool // -}} marker
+	// SelfClosing marks a component tag written as <x-name ... />.
+	SelfClosing bool
+	Pos         Pos
+	End         int // byte offset just past the token
+}
+
+// goActionKeywords are the first words of {{ }} actions that belong to
+// html/template itself and are passed through instead of being echoed.
+var goActionKeywords = map[string]bool{
+	"if": true, "else": true, "end": true, "range": true, "with": true,
+	"define": true, "block": true, "template": true, "break": true, "continue": true,
+}
+
+// declRe matches Go template variable declarations and assignments.
+var declRe = regexp.MustCompile(`^\$\w+\s*(,\s*\$\w+\s*)?:?=([^=]|$)`)
+
+// Lexer splits a Blade template into tokens.
+type Lexer struct {
+	src        string
+	pos        int
+	start      int // offset of the token being lexed
+	lineStarts []int
+	known      func(string) bool
+}
+
+// NewLexer creates a lexer for src. known reports whether a directive name is
+// recognised; unknown @words (e-mail addresses, CSS at-rules) stay literal text.
+func NewLexer(src string, known func(string) bool) *Lexer {
+	l := &Lexer{src: src, known: known, lineStarts: []int{0}}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			l.lineStarts = append(l.lineStarts, i+1)
+		}
+	}
+	return l
+}
+
+// PosFor converts a byte offset into a Pos.
+func (l *Lexer) PosFor(offset int) Pos {
+	lo, hi := 0, len(l.lineStarts)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if l.lineStarts[mid] <= offset {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	start := l.lineStarts[lo]
+	if offset > len(l.src) {
+		offset = len(l.src)
+	}
+	return Pos{Offset: offset, Line: lo + 1, Col: len([]rune(l.src[start:offset])) + 1}
+}
+
+func (l *Lexer) errorf(offset int, format string, args ...interface{}) error {
+	return &Error{Pos: l.PosFor(offset), Msg: fmt.Sprintf(format, args...)}
+}
+
+// Tokens lexes the whole input.
+func (l *Lexer) Tokens() ([]Token, error) {
+	var toks []Token
+	for {
+		t, err := l.Next()
+		if err != nil {
+			return nil, err
+		}
+		if t.Typ == TokEOF {
+			return toks, nil
+		}
+		toks = append(toks, t)
+	}
+}
+
+// Next returns the next token.
+func (l *Lexer) Next() (Token, error) {
+	if l.pos >= len(l.src) {
+		return Token{Typ: TokEOF, Pos: l.PosFor(len(l.src)), End: len(l.src)}, nil
+	}
+	start := l.pos
+	l.start = start
+	var text strings.Builder
+	for l.pos < len(l.src) {
+		if tok, ok, err := l.verbatim(); err != nil {
+			return Token{}, err
+		} else if ok {
+			if text.Len() > 0 {
+				// emit pending text first and rewind to the @verbatim
+				l.pos = tok.Pos.Offset - len("@verbatim")
+				return Token{Typ: TokText, Val: text.String(), Pos: l.PosFor(start), End: l.pos}, nil
+			}
+			return tok, nil
+		}
+		if tok, ok, err := l.special(); err != nil {
+			return Token{}, err
+		} else if ok {
+			if text.Len() > 0 {
+				// emit pending text first and rewind to lex the special token again
+				l.pos = tok.Pos.Offset
+				return Token{Typ: TokText, Val: text.String(), Pos: l.PosFor(start), End: l.pos}, nil
+			}
+			return tok, nil
+		}
+		// escaped echo: @{{ name }} -> literal {{ name }}
+		if strings.HasPrefix(l.src[l.pos:], "@{{") {
+			text.WriteString("{{")
+			l.pos += 3
+			continue
+		}
+		// escaped directive: @@if -> literal @if
+		if name, n := l.escapedDirective(); n > 0 {
+			text.WriteString("@" + name)
+			l.pos += n
+			continue
+		}
+		text.WriteByte(l.src[l.pos])
+		l.pos++
+	}
+	return Token{Typ: TokText, Val: text.String(), Pos: l.PosFor(start), End: l.pos}, nil
+}
+
+// verbatim lexes a @verbatim ... @endverbatim block into a text token
+// holding the block's content, which is not parsed for echoes or directives.
+func (l *Lexer) verbatim() (Token, bool, error) {
+	const open, close = "@verbatim", "@endverbatim"
+	rest := l.src[l.pos:]
+	if !strings.HasPrefix(rest, open) || (len(rest) > len(open) && isWordByte(rest[len(open)])) {
+		return Token{}, false, nil
+	}
+	end := strings.Index(rest, close)
+	if end < 0 {
+		return Token{}, false, l.errorf(l.pos, "unclosed @verbatim")
+	}
+	t := Token{Typ: TokText, Val: rest[len(open):end], Pos: l.PosFor(l.pos + len(open))}
+	l.pos += end + len(close)
+	t.End = l.pos
+	return t, true, nil
+}
+
+// special tries to lex an echo, comment, action or directive at the current position.
+func (l *Lexer) special() (Token, bool, error) {
+	rest := l.src[l.pos:]
+	switch {
+	case strings.HasPrefix(rest, "{{--"):
+		end := strings.Index(rest[4:], "--}}")
+		if end < 0 {
+			return Token{}, false, l.errorf(l.pos, "unclosed comment {{--")
+		}
+		t := Token{Typ: TokComment, Val: rest[4 : 4+end], Pos: l.PosFor(l.pos)}
+		l.pos += 4 + end + 4
+		t.End = l.pos
+		return t, true, nil
+	case strings.HasPrefix(rest, "{!!"):
+		end := l.scanUntil(l.pos+3, "!!}")
+		if end < 0 {
+			return Token{}, false, l.errorf(l.pos, "unclosed raw echo {!!")
+		}
+		t := Token{Typ: TokRawEcho, Val: strings.TrimSpace(l.src[l.pos+3 : end]), Pos: l.PosFor(l.pos)}
+		l.pos = end + 3
+		t.End = l.pos
+		return t, true, nil
+	case strings.HasPrefix(rest, "{{"):
+		end := l.scanUntil(l.pos+2, "}}")
+		if end < 0 {
+			return Token{}, false, l.errorf(l.pos, "unclosed {{")
+		}
+		t := Token{Typ: TokEcho, Pos: l.PosFor(l.pos)}
+		inner := l.src[l.pos+2 : end]
+		if len(inner) >= 2 && inner[0] == '-' && isSpace(rune(inner[1])) {
+			t.TrimLeft = true
+			inner = inner[1:]
+		}
+		if n := len(inner); n >= 2 && inner[n-1] == '-' && isSpace(rune(inner[n-2])) {
+			t.TrimRight = true
+			inner = inner[:n-1]
+		}
+		t.Val = strings.TrimSpace(inner)
+		if isGoAction(t.Val) {
+			t.Typ = TokAction
+		}
+		l.pos = end + 2
+		t.End = l.pos
+		return t, true, nil
+	case strings.HasPrefix(rest, "<x-"), strings.HasPrefix(rest, "</x-"):
+		return l.component()
+	case rest[0] == '@':
+		return l.directive()
+	}
+	return Token{}, false, nil
+}
+
+// directive lexes @name(args). Returns ok=false when the @ is not a known
+// directive or, like Laravel's \B@, follows a word character of the text,
+// as in support@include.io or me@else.com. Right after another token, as in
+// @csrf@endif, it is still a directive.
+func (l *Lexer) directive() (Token, bool, error) {
+	name := l.ident(l.pos + 1)
+	if name == "" || l.known == nil || !l.known(name) {
+		return Token{}, false, nil
+	}
+	if l.pos > l.start && isWordByte(l.src[l.pos-1]) {
+		return Token{}, false, nil
+	}
+	t := Token{Typ: TokDirective, Val: name, Pos: l.PosFor(l.pos)}
+	p := l.pos + 1 + len(name)
+	q := p
+	for q < len(l.src) && (l.src[q] == ' ' || l.src[q] == '\t') {
+		q++
+	}
+	if q < len(l.src) && l.src[q] == '(' {
+		end, err := l.matchParen(q)
+		if err != nil {
+			return Token{}, false, err
+		}
+		t.Args = strings.TrimSpace(l.src[q+1 : end])
+		t.HasArgs = true
+		p = end + 1
+	}
+	l.pos = p
+	t.End = p
+	return t, true, nil
+}
+
+// component lexes a <x-name attrs>, <x-name attrs /> or </x-name> tag.
+// Returns ok=false when the text is not a well-formed component tag.
+func (l *Lexer) component() (Token, bool, error) {
+	p := l.pos + len("<x-")
+	closing := strings.HasPrefix(l.src[l.pos:], "</")
+	if closing {
+		p++
+	}
+	q := p
+	for q < len(l.src) && isTagNameByte(l.src[q]) {
+		q++
+	}
+	if q == p {
+		return Token{}, false, nil
+	}
+	t := Token{Typ: TokComponent, Val: l.src[p:q], Pos: l.PosFor(l.pos)}
+	if closing {
+		t.Typ = TokComponentEnd
+	}
+	end := l.scanUntil(q, ">")
+	if end < 0 {
+		return Token{}, false, l.errorf(l.pos, "unclosed <x-%s> tag", t.Val)
+	}
+	attrs := l.src[q:end]
+	if strings.HasSuffix(attrs, "/") {
+		t.SelfClosing = true
+		attrs = attrs[:len(attrs)-1]
+	}
+	if closing && strings.TrimSpace(attrs) != "" {
+		return Token{}, false, l.errorf(l.pos, "unexpected attributes on </x-%s>", t.Val)
+	}
+	if !closing && attrs != "" && !isSpace(rune(attrs[0])) {
+		return Token{}, false, nil
+	}
+	t.Args = strings.TrimSpace(attrs)
+	l.pos = end + 1
+	t.End = l.pos
+	return t, true, nil
+}
+
+// escapedDirective reports a @@name sequence for a known directive and its length.
+func (l *Lexer) escapedDirective() (string, int) {
+	if !strings.HasPrefix(l.src[l.pos:], "@@") {
+		return "", 0
+	}
+	name := l.ident(l.pos + 2)
+	if name == "" || l.known == nil || !l.known(name) {
+		return "", 0
+	}
+	return name, 2 + len(name)
+}
+
+func (l *Lexer) ident(p int) string {
+	q := p
+	for q < len(l.src) && isWordByte(l.src[q]) {
+		q++
+	}
+	if q == p || (l.src[p] >= '0' && l.src[p] <= '9') {
+		return ""
+	}
+	return l.src[p:q]
+}
+
+// matchParen returns the offset of the parenthesis closing the one at open.
+func (l *Lexer) matchParen(open int) (int, error) {
+	depth := 0
+	for i := open; i < len(l.src); i++ {
+		switch c := l.src[i]; c {
+		case '"', '\'', '`':
+			j := skipQuoted(l.src, i)
+			if j < 0 {
+				return -1, l.errorf(i, "unterminated string in directive arguments")
+			}
+			i = j
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return -1, l.errorf(open, "unclosed ( in directive arguments")
+}
+
+// scanUntil finds delim starting at from, skipping quoted strings.
+func (l *Lexer) scanUntil(from int, delim string) int {
+	for i := from; i < len(l.src); i++ {
+		if strings.HasPrefix(l.src[i:], delim) {
+			return i
+		}
+		if c := l.src[i]; c == '"' || c == '\'' || c == '`' {
+			j := skipQuoted(l.src, i)
+			if j < 0 {
+				return -1
+			}
+			i = j
+		}
+	}
+	return -1
+}
+
+// skipQuoted returns the offset of the quote closing the one at i, or -1.
+func skipQuoted(s string, i int) int {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == '\\' && q != '`' {
+			j++
+			continue
+		}
+		if s[j] == q {
+			return j
+		}
+	}
+	return -1
+}
+
+func isGoAction(s string) bool {
+	if strings.HasPrefix(s, "/*") {
+		return true
+	}
+	i := 0
+	for i < len(s) && isWordByte(s[i]) {
+		i++
+	}
+	if goActionKeywords[s[:i]] {
+		return true
+	}
+	// variable declarations and assignments: {{ $x := ... }}, {{ $i, $v := ... }}
+	return declRe.MatchString(s)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isTagNameByte(c byte) bool {
+	return isWordByte(c) || c == '-' || c == '.' || c == ':'
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
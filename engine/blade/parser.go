@@ -0,0 +1,391 @@
+package blade
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is a lexing or parsing error with its template position.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Col, e.Msg)
+}
+
+// BlockSpec describes how a block directive pairs with its clauses and end.
+type BlockSpec struct {
+	End    []string // directives closing the block, e.g. endif
+	Middle []string // intermediate clauses, e.g. elseif, else
+	// NeedsArgs marks openers that are only directives when followed by an
+	// argument list; a bare "@if" in prose stays literal text.
+	NeedsArgs bool
+	// Inline optionally reports that a particular use of the directive has no
+	// body, e.g. @section('title', 'Home') or @php($x = 1).
+	Inline func(args string, hasArgs bool) bool
+}
+
+// Syntax is the set of directives the lexer recognises and the block
+// structure the parser enforces.
+type Syntax struct {
+	Directives map[string]bool
+	Blocks     map[string]BlockSpec
+}
+
+// DefaultSyntax returns the built-in Blade directives.
+func DefaultSyntax() *Syntax {
+	s := &Syntax{Directives: map[string]bool{}, Blocks: map[string]BlockSpec{}}
+	s.Block("if", BlockSpec{End: []string{"endif"}, Middle: []string{"elseif", "else"}, NeedsArgs: true})
+	s.Block("unless", BlockSpec{End: []string{"endunless"}, Middle: []string{"else"}, NeedsArgs: true})
+	s.Block("foreach", BlockSpec{End: []string{"endforeach"}, NeedsArgs: true})
+	s.Block("forelse", BlockSpec{End: []string{"endforelse"}, Middle: []string{"empty"}, NeedsArgs: true})
+	s.Block("for", BlockSpec{End: []string{"endfor"}, NeedsArgs: true})
+	s.Block("while", BlockSpec{End: []string{"endwhile"}, NeedsArgs: true})
+	s.Block("section", BlockSpec{
+		End:       []string{"endsection", "stop", "show", "append"},
+		NeedsArgs: true,
+		Inline:    func(args string, _ bool) bool { return len(SplitArgs(args)) > 1 },
+	})
+	s.Block("hasSection", BlockSpec{End: []string{"endif"}, Middle: []string{"else"}, NeedsArgs: true})
+	s.Block("sectionMissing", BlockSpec{End: []string{"endif"}, Middle: []string{"else"}, NeedsArgs: true})
+	pushInline := func(args string, _ bool) bool { return len(SplitArgs(args)) > 1 }
+	s.Block("push", BlockSpec{End: []string{"endpush"}, NeedsArgs: true, Inline: pushInline})
+	s.Block("prepend", BlockSpec{End: []string{"endprepend"}, NeedsArgs: true, Inline: pushInline})
+	s.Block("pushOnce", BlockSpec{End: []string{"endPushOnce", "endpushOnce"}, NeedsArgs: true})
+	s.Block("prependOnce", BlockSpec{End: []string{"endPrependOnce", "endprependOnce"}, NeedsArgs: true})
+	s.Block("php", BlockSpec{
+		End:    []string{"endphp"},
+		Inline: func(_ string, hasArgs bool) bool { return hasArgs },
+	})
+	s.Block("auth", BlockSpec{End: []string{"endauth"}, Middle: []string{"else"}})
+	s.Block("guest", BlockSpec{End: []string{"endguest"}, Middle: []string{"else"}})
+	s.Block("can", BlockSpec{End: []string{"endcan"}, Middle: []string{"elsecan", "else"}, NeedsArgs: true})
+	s.Block("cannot", BlockSpec{End: []string{"endcannot"}, Middle: []string{"elsecannot", "else"}, NeedsArgs: true})
+	s.Block("role", BlockSpec{End: []string{"endrole"}, Middle: []string{"elserole", "else"}, NeedsArgs: true})
+	s.Block("fragment", BlockSpec{End: []string{"endfragment"}, NeedsArgs: true})
+	s.Block("error", BlockSpec{End: []string{"enderror"}, Middle: []string{"else"}, NeedsArgs: true})
+	s.Directive("yield", "include", "includeIf", "includeWhen", "includeUnless", "includeFirst", "each", "extends", "break", "continue", "props", "parent", "stack")
+	s.Directive("class", "style", "attr", "checked", "selected", "disabled", "readonly", "required", "json", "js", "csrf", "method", "flush")
+	return s
+}
+
+// Directive registers standalone directive names.
+func (s *Syntax) Directive(names ...string) {
+	for _, n := range names {
+		s.Directives[n] = true
+	}
+}
+
+// Block registers a block directive together with its clause and end names.
+func (s *Syntax) Block(name string, spec BlockSpec) {
+	s.Blocks[name] = spec
+	s.Directive(name)
+	s.Directive(spec.End...)
+	s.Directive(spec.Middle...)
+}
+
+// Clone returns a copy that can be extended without affecting s.
+func (s *Syntax) Clone() *Syntax {
+	c := &Syntax{Directives: make(map[string]bool, len(s.Directives)), Blocks: make(map[string]BlockSpec, len(s.Blocks))}
+	for k, v := range s.Directives {
+		c.Directives[k] = v
+	}
+	for k, v := range s.Blocks {
+		c.Blocks[k] = v
+	}
+	return c
+}
+
+// Known reports whether name is a registered directive.
+func (s *Syntax) Known(name string) bool {
+	return s.Directives[name]
+}
+
+// frame is an open block or component tag on the parser stack.
+type frame struct {
+	block *BlockNode
+	spec  BlockSpec
+	comp  *ComponentNode
+}
+
+// body returns the node list currently being appended to.
+func (f *frame) body() *[]Node {
+	if f.comp != nil {
+		return &f.comp.Body
+	}
+	if n := len(f.block.Clauses); n > 0 {
+		return &f.block.Clauses[n-1].Body
+	}
+	return &f.block.Body
+}
+
+// describe names the open construct for error messages.
+func (f *frame) describe() string {
+	if f.comp != nil {
+		return fmt.Sprintf("<x-%s> opened at %s", f.comp.tag(), f.comp.Pos)
+	}
+	return fmt.Sprintf("@%s opened at %s", f.block.Name, f.block.Pos)
+}
+
+// tag returns the tag name as written, e.g. "alert" or "slot:footer".
+func (n *ComponentNode) tag() string {
+	if n.Name == "slot" && n.Slot != "" {
+		return "slot:" + n.Slot
+	}
+	return n.Name
+}
+
+// newComponent builds a component or slot node from its opening tag.
+func newComponent(t Token) (*ComponentNode, error) {
+	n := &ComponentNode{Pos: t.Pos, Name: t.Val, SelfClosing: t.SelfClosing}
+	attrs, err := ParseAttrs(t.Args)
+	if err != nil {
+		return nil, &Error{Pos: t.Pos, Msg: err.Error()}
+	}
+	n.Attrs = attrs
+	if slot, ok := strings.CutPrefix(t.Val, "slot:"); ok {
+		n.Name, n.Slot = "slot", slot
+	} else if t.Val == "slot" {
+		for i, a := range attrs {
+			if a.Name == "name" && !a.Bound {
+				n.Slot = a.Value
+				n.Attrs = append(attrs[:i:i], attrs[i+1:]...)
+				break
+			}
+		}
+		if n.Slot == "" {
+			return nil, &Error{Pos: t.Pos, Msg: "<x-slot> requires a name"}
+		}
+	}
+	return n, nil
+}
+
+// Parse parses src into a Document using the given syntax.
+func Parse(src string, syn *Syntax) (*Document, error) {
+	if syn == nil {
+		syn = DefaultSyntax()
+	}
+	l := NewLexer(src, syn.Known)
+	toks, err := l.Tokens()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	var stack []*frame
+	out := func() *[]Node {
+		if len(stack) == 0 {
+			return &doc.Nodes
+		}
+		return stack[len(stack)-1].body()
+	}
+
+	for _, t := range toks {
+		switch t.Typ {
+		case TokText:
+			*out() = append(*out(), &TextNode{Pos: t.Pos, Text: t.Val})
+		case TokEcho, TokRawEcho:
+			*out() = append(*out(), &EchoNode{Pos: t.Pos, Expr: t.Val, Raw: t.Typ == TokRawEcho, TrimLeft: t.TrimLeft, TrimRight: t.TrimRight})
+		case TokAction:
+			*out() = append(*out(), &ActionNode{Pos: t.Pos, Text: t.Val, TrimLeft: t.TrimLeft, TrimRight: t.TrimRight})
+		case TokComment:
+			// dropped
+		case TokComponent:
+			n, err := newComponent(t)
+			if err != nil {
+				return nil, err
+			}
+			if n.SelfClosing {
+				*out() = append(*out(), n)
+				continue
+			}
+			stack = append(stack, &frame{comp: n})
+		case TokComponentEnd:
+			var top *frame
+			if len(stack) > 0 {
+				top = stack[len(stack)-1]
+			}
+			if top == nil || top.comp == nil || (t.Val != top.comp.Name && t.Val != top.comp.tag()) {
+				if top != nil {
+					return nil, &Error{Pos: t.Pos, Msg: fmt.Sprintf("unexpected </x-%s> inside %s", t.Val, top.describe())}
+				}
+				return nil, &Error{Pos: t.Pos, Msg: fmt.Sprintf("unexpected </x-%s> without matching <x-%s>", t.Val, t.Val)}
+			}
+			top.comp.EndPos = t.Pos
+			stack = stack[:len(stack)-1]
+			*out() = append(*out(), top.comp)
+		case TokDirective:
+			// clauses and ends of the innermost open block take precedence
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				if contains(top.spec.Middle, t.Val) {
+					top.block.Clauses = append(top.block.Clauses, &Clause{Pos: t.Pos, Name: t.Val, Args: t.Args, HasArgs: t.HasArgs})
+					continue
+				}
+				if contains(top.spec.End, t.Val) {
+					top.block.End = t.Val
+					top.block.EndPos = t.Pos
+					stack = stack[:len(stack)-1]
+					*out() = append(*out(), top.block)
+					continue
+				}
+			}
+			spec, isBlock := syn.Blocks[t.Val]
+			if isBlock && spec.NeedsArgs && !t.HasArgs {
+				*out() = append(*out(), &TextNode{Pos: t.Pos, Text: "@" + t.Val})
+				continue
+			}
+			if isBlock && (spec.Inline == nil || !spec.Inline(t.Args, t.HasArgs)) {
+				stack = append(stack, &frame{
+					block: &BlockNode{Pos: t.Pos, Name: t.Val, Args: t.Args, HasArgs: t.HasArgs},
+					spec:  spec,
+				})
+				continue
+			}
+			if opener := syn.openerOf(t.Val); opener != "" {
+				if len(stack) > 0 {
+					return nil, &Error{Pos: t.Pos, Msg: fmt.Sprintf("unexpected @%s inside %s", t.Val, stack[len(stack)-1].describe())}
+				}
+				return nil, &Error{Pos: t.Pos, Msg: fmt.Sprintf("unexpected @%s without matching @%s", t.Val, opener)}
+			}
+			*out() = append(*out(), &DirectiveNode{Pos: t.Pos, Name: t.Val, Args: t.Args, HasArgs: t.HasArgs})
+		}
+	}
+
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if top.comp != nil {
+			return nil, &Error{Pos: top.comp.Pos, Msg: fmt.Sprintf("unclosed <x-%s>", top.comp.tag())}
+		}
+		return nil, &Error{Pos: top.block.Pos, Msg: fmt.Sprintf("unclosed @%s", top.block.Name)}
+	}
+	return doc, nil
+}
+
+// openerOf returns the block a clause or end directive belongs to, if any.
+func (s *Syntax) openerOf(name string) string {
+	if _, isBlock := s.Blocks[name]; isBlock {
+		return ""
+	}
+	// @endif belongs to @if, even though @hasSection also ends with it
+	if opener, ok := strings.CutPrefix(name, "end"); ok {
+		if spec, isBlock := s.Blocks[opener]; isBlock && contains(spec.End, name) {
+			return opener
+		}
+	}
+	found := ""
+	for opener, spec := range s.Blocks {
+		if contains(spec.End, name) || contains(spec.Middle, name) {
+			// prefer the alphabetically first opener so messages are stable
+			if found == "" || opener < found {
+				found = opener
+			}
+		}
+	}
+	return found
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitArgs splits a directive argument list on top-level commas, ignoring
+// commas nested in quotes, parentheses or brackets.
+func SplitArgs(args string) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(args); i++ {
+		switch c := args[i]; c {
+		case '"', '\'', '`':
+			if j := skipQuoted(args, i); j >= 0 {
+				i = j
+			}
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(args[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(args[start:]); rest != "" || len(parts) > 0 {
+		parts = append(parts, rest)
+	}
+	return parts
+}
+
+// Unquote strips matching single or double quotes around a literal string argument.
+func Unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ParseAttrs parses the attributes of a component tag: name="value",
+// name='value', :name="$expr" for bound expressions and bare names.
+func ParseAttrs(src string) ([]Attr, error) {
+	var attrs []Attr
+	i := 0
+	for {
+		for i < len(src) && isSpace(rune(src[i])) {
+			i++
+		}
+		if i >= len(src) {
+			return attrs, nil
+		}
+		j := i
+		for j < len(src) && !isSpace(rune(src[j])) && src[j] != '=' {
+			j++
+		}
+		a := Attr{Name: src[i:j]}
+		if strings.HasPrefix(a.Name, ":") {
+			a.Name, a.Bound = a.Name[1:], true
+		}
+		if a.Name == "" {
+			return nil, fmt.Errorf("malformed attribute near %q", src[i:])
+		}
+		i = j
+		for i < len(src) && isSpace(rune(src[i])) {
+			i++
+		}
+		if i < len(src) && src[i] == '=' {
+			i++
+			for i < len(src) && isSpace(rune(src[i])) {
+				i++
+			}
+			if i < len(src) && (src[i] == '"' || src[i] == '\'') {
+				end := strings.IndexByte(src[i+1:], src[i])
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated value for attribute %q", a.Name)
+				}
+				a.Value = src[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				j = i
+				for j < len(src) && !isSpace(rune(src[j])) {
+					j++
+				}
+				a.Value = src[i:j]
+				i = j
+			}
+			a.HasValue = true
+		}
+		if a.Bound && !a.HasValue {
+			return nil, fmt.Errorf("bound attribute :%s requires a value", a.Name)
+		}
+		attrs = append(attrs, a)
+	}
+}
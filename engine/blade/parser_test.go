@@ -0,0 +1,183 @@
+package blade
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNestedBlocksPairCorrectly(t *testing.T) {
+	src := `@foreach($items as $item)@if($item.On)<b>{{ $item.Name }}</b>@else off @endif@endforeach`
+	doc, err := Parse(src, nil)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if len(doc.Nodes) != 1 {
+		t.Fatalf("expected a single foreach node, got %#v", doc.Nodes)
+	}
+	loop, ok := doc.Nodes[0].(*BlockNode)
+	if !ok || loop.Name != "foreach" || loop.End != "endforeach" {
+		t.Fatalf("expected foreach block, got %#v", doc.Nodes[0])
+	}
+	cond, ok := loop.Body[0].(*BlockNode)
+	if !ok || cond.Name != "if" || len(cond.Clauses) != 1 || cond.Clauses[0].Name != "else" {
+		t.Fatalf("expected nested if/else inside foreach, got %#v", loop.Body[0])
+	}
+}
+
+func TestParseDirectiveInsideAttribute(t *testing.T) {
+	doc, err := Parse(`<p class="@if($a) x @else y @endif">`, nil)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if _, ok := doc.Nodes[1].(*BlockNode); !ok {
+		t.Fatalf("expected if block inside attribute, got %#v", doc.Nodes)
+	}
+	if txt, ok := doc.Nodes[2].(*TextNode); !ok || txt.Text != `">` {
+		t.Fatalf("expected trailing text after @endif, got %#v", doc.Nodes[2])
+	}
+}
+
+func TestParseLeavesUnknownAtSignsAsText(t *testing.T) {
+	src := "mail contact@mysite.com, css bootstrap@5.3.0, prose about @if and @@foreach"
+	doc, err := Parse(src, nil)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var sb strings.Builder
+	for _, n := range doc.Nodes {
+		txt, ok := n.(*TextNode)
+		if !ok {
+			t.Fatalf("expected only text nodes, got %#v", n)
+		}
+		sb.WriteString(txt.Text)
+	}
+	want := "mail contact@mysite.com, css bootstrap@5.3.0, prose about @if and @foreach"
+	if sb.String() != want {
+		t.Fatalf("got %q, want %q", sb.String(), want)
+	}
+}
+
+func TestParseLeavesEmailAddressesAsText(t *testing.T) {
+	src := "mail support@include.io or sales@each.io (@if($a)@csrf@endif)"
+	doc, err := Parse(src, nil)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	txt, ok := doc.Nodes[0].(*TextNode)
+	if !ok || txt.Text != "mail support@include.io or sales@each.io (" {
+		t.Fatalf("expected the addresses as text, got %#v", doc.Nodes[0])
+	}
+	block, ok := doc.Nodes[1].(*BlockNode)
+	if !ok || block.Name != "if" || len(block.Body) != 1 {
+		t.Fatalf("expected @if with @csrf after a non-word character, got %#v", doc.Nodes[1])
+	}
+}
+
+func TestLexerKeepsClauseNamesInAddressesAsText(t *testing.T) {
+	const addrs = "me@else.com info@empty.org shop@show.io mailto:x@stop.io"
+	known := DefaultSyntax().Known
+	toks, err := NewLexer(addrs, known).Tokens()
+	if err != nil {
+		t.Fatalf("lex error: %v", err)
+	}
+	if len(toks) != 1 || toks[0].Typ != TokText || toks[0].Val != addrs {
+		t.Fatalf("expected a single text token, got %#v", toks)
+	}
+
+	doc, err := Parse("@if($a)"+addrs+" @else none @endif", nil)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	block, ok := doc.Nodes[0].(*BlockNode)
+	if !ok || len(block.Clauses) != 1 {
+		t.Fatalf("expected @if with a single @else, got %#v", doc.Nodes[0])
+	}
+	if txt, ok := block.Body[0].(*TextNode); !ok || txt.Text != addrs+" " {
+		t.Fatalf("expected the addresses as the @if body, got %#v", block.Body)
+	}
+}
+
+func TestParseReportsUnclosedBlockPosition(t *testing.T) {
+	_, err := Parse("line one\n  @if($x)\nbody", nil)
+	perr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if perr.Pos.Line != 2 || perr.Pos.Col != 3 {
+		t.Fatalf("expected error at 2:3, got %s", perr.Pos)
+	}
+}
+
+func TestParseMismatchedEnd(t *testing.T) {
+	_, err := Parse("@if($x) @endforeach", nil)
+	if err == nil || !strings.Contains(err.Error(), "unexpected @endforeach") {
+		t.Fatalf("expected mismatched end error, got %v", err)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	got := SplitArgs(`'card', ['a' => 1, 'b' => f(2, 3)], "x,y"`)
+	want := []string{`'card'`, `['a' => 1, 'b' => f(2, 3)]`, `"x,y"`}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("arg %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseComponentTagsAndSlots(t *testing.T) {
+	src := `<x-card class="p-2" :user="$u" open><x-slot:title>T</x-slot>body<x-icon name='x'/></x-card>`
+	doc, err := Parse(src, nil)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	card, ok := doc.Nodes[0].(*ComponentNode)
+	if !ok || card.Name != "card" || len(card.Attrs) != 3 {
+		t.Fatalf("expected card component with 3 attributes, got %#v", doc.Nodes[0])
+	}
+	if a := card.Attrs[1]; a.Name != "user" || !a.Bound || a.Value != "$u" {
+		t.Fatalf("expected bound :user attribute, got %#v", a)
+	}
+	if a := card.Attrs[2]; a.Name != "open" || a.HasValue {
+		t.Fatalf("expected bare open attribute, got %#v", a)
+	}
+	if slot, ok := card.Body[0].(*ComponentNode); !ok || slot.Name != "slot" || slot.Slot != "title" {
+		t.Fatalf("expected title slot, got %#v", card.Body[0])
+	}
+	if icon, ok := card.Body[2].(*ComponentNode); !ok || !icon.SelfClosing || icon.Attrs[0].Value != "x" {
+		t.Fatalf("expected self-closing icon, got %#v", card.Body[2])
+	}
+}
+
+func TestParseMismatchedComponentEnd(t *testing.T) {
+	_, err := Parse("<x-card>@if($a)</x-card>@endif", nil)
+	if err == nil || !strings.Contains(err.Error(), "unexpected </x-card> inside @if") {
+		t.Fatalf("expected mismatched component end error, got %v", err)
+	}
+}
+
+func TestParseVerbatimAndEscapedEchoes(t *testing.T) {
+	src := "a @{{ name }} @verbatim<p>{{ msg }} @if($x)</p>@endverbatim {{ $y }}"
+	doc, err := Parse(src, nil)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if len(doc.Nodes) != 4 {
+		t.Fatalf("expected text, verbatim text, text and echo nodes, got %#v", doc.Nodes)
+	}
+	if txt, ok := doc.Nodes[0].(*TextNode); !ok || txt.Text != "a {{ name }} " {
+		t.Fatalf("expected escaped echo as text, got %#v", doc.Nodes[0])
+	}
+	if txt, ok := doc.Nodes[1].(*TextNode); !ok || txt.Text != "<p>{{ msg }} @if($x)</p>" || txt.Pos.Col != 24 {
+		t.Fatalf("expected verbatim content at 1:24, got %#v", doc.Nodes[1])
+	}
+	if _, ok := doc.Nodes[3].(*EchoNode); !ok {
+		t.Fatalf("expected echo after @endverbatim, got %#v", doc.Nodes[3])
+	}
+	if _, err := Parse("@verbatim {{ x }}", nil); err == nil || !strings.Contains(err.Error(), "unclosed @verbatim") {
+		t.Fatalf("expected unclosed @verbatim error, got %v", err)
+	}
+}
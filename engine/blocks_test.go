@@ -25,7 +25,7 @@ func TestNestedBlocksAndSectionOverride(t *testing.T) {
 	// page overrides inner block only
 	pagePath := filepath.Join(pagesDir, "nested_home.blade.tpl")
 	pageContent := `@extends('layouts/nested.blade.tpl')
-@section('inner')Overridden Inner@endsection
+@section('inner')Overridden Inner @endsection
 @section('content')<p>Body</p>@endsection`
 	if err := os.WriteFile(pagePath, []byte(pageContent), 0644); err != nil {
 		t.Fatalf("write page: %v", err)
@@ -0,0 +1,1372 @@
+package engine
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"blade_engine/engine/blade"
+	"blade_engine/engine/expr"
+)
+
+// codegen lowers a parsed Blade document into html/template source.
+type codegen struct {
+	c            *Compiler
+	templatePath string
+	file         string    // template name used in source locations
+	src          string    // source of file, for positions inside expressions
+	cur          blade.Pos // position of the node being generated
+	out          *mappedBuilder
+	scopes       []*scope
+	seq          int                    // counter for unique generated variable names
+	defines      map[string]*mappedText // included views, emitted after the body
+	defineOrder  []string
+	stacks       bool     // @push or @stack used, see stacksTemplate
+	flushes      bool     // @flush used, see flushTemplate
+	components   []string // components being expanded, to detect recursion
+	exprErr      error    // first invalid expression met by expr, see node
+	expanding    []string // custom directives being expanded, likewise
+}
+
+// scope tracks the variables visible inside a block and whether the block
+// rebinds the template dot (range, with), which forces root lookups via $.
+type scope struct {
+	vars       map[string]string // blade variable name -> template reference
+	dotChanged bool
+	goAction   bool // opened by a native {{ range }}/{{ if }}/... action
+	loop       bool // body of a @foreach/@forelse, where $loop is declared
+	breakable  bool // body of a range, where {{break}} and {{continue}} are allowed
+	// isolated marks a component body: outer variables are hidden and
+	// unknown names resolve against the component data variable.
+	isolated bool
+	data     string
+	slots    map[string]*mappedText // slot content by name, echoed inline
+	// declared holds the data names a template or component body may
+	// read in strict mode: its @props, and $attributes and slots.
+	declared map[string]bool
+}
+
+var (
+	dollarVarRe = regexp.MustCompile(`\$(\w+)(\.?)`)
+	goDeclRe    = regexp.MustCompile(`\$(\w+)\s*(?:,\s*\$(\w+)\s*)?:=`)
+	stackNameRe = regexp.MustCompile(`^[\w.:/-]+$`)
+	// $i = 0; $i < $n; $i++ (also <=, >, >=, ++$i, $i--, $i += 2, ...)
+	forRe      = regexp.MustCompile(`(?s)^\s*\$(\w+)\s*=\s*(.+?)\s*;\s*\$(\w+)\s*(<=|>=|<|>|!=)\s*(.+?)\s*;\s*(?:\$(\w+)\s*(\+\+|--|\+=|-=)\s*(.*?)|(\+\+|--)\s*\$(\w+))\s*$`)
+	slotEchoRe = regexp.MustCompile(`^\$(\w+)$`)
+	foreachRe  = regexp.MustCompile(`(?s)^(.*?)\s+as\s+(?:\$(\w+)\s*=>\s*)?\$(\w+)$`)
+	// an action written so far, and a start tag left open at the end
+	actionRe  = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+	openTagRe = regexp.MustCompile(`<[a-zA-Z][\w:-]*(\s[^<>]*)?$`)
+)
+
+func newCodegen(c *Compiler, templatePath string) *codegen {
+	g := &codegen{c: c, templatePath: templatePath, file: c.sourceName(templatePath), out: &mappedBuilder{}, defines: map[string]*mappedText{}}
+	g.pushScope(&scope{})
+	return g
+}
+
+// generate emits the template source for doc.
+func (g *codegen) generate(doc *blade.Document) (*mappedText, error) {
+	g.scopes[0].declared = declaredProps(doc)
+	if err := g.nodes(doc.Nodes); err != nil {
+		return nil, err
+	}
+	if g.stacks {
+		g.out.write(fmt.Sprintf("{{define %q}}{{end}}", stacksTemplate), SourceLocation{}, false)
+	}
+	if g.flushes {
+		g.out.write(fmt.Sprintf("{{define %q}}{{end}}", flushTemplate), SourceLocation{}, false)
+	}
+	for _, name := range g.defineOrder {
+		g.out.write(fmt.Sprintf("{{define %q}}", name), SourceLocation{}, false)
+		g.out.writeMapped(g.defines[name])
+		g.out.write("{{end}}", SourceLocation{}, false)
+	}
+	return g.out.mapped(), nil
+}
+
+func (g *codegen) errorf(pos blade.Pos, format string, args ...interface{}) error {
+	return &TemplateError{Template: g.file, Location: g.loc(pos), Message: fmt.Sprintf(format, args...)}
+}
+
+func (g *codegen) loc(pos blade.Pos) SourceLocation {
+	return SourceLocation{File: g.file, Line: pos.Line, Col: pos.Col}
+}
+
+// emit writes generated text attributed to the current node.
+func (g *codegen) emit(s string) {
+	g.out.write(s, g.loc(g.cur), false)
+}
+
+// at sets the source position subsequent emits are attributed to.
+func (g *codegen) at(pos blade.Pos) {
+	g.cur = pos
+}
+
+func (g *codegen) nodes(ns []blade.Node) error {
+	for _, n := range ns {
+		if err := g.node(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *codegen) node(n blade.Node) error {
+	g.at(n.Position())
+	var err error
+	switch n := n.(type) {
+	case *blade.TextNode:
+		g.text(n)
+	case *blade.EchoNode:
+		g.echo(n)
+	case *blade.ActionNode:
+		g.goAction(n)
+	case *blade.DirectiveNode:
+		err = g.directive(n)
+	case *blade.BlockNode:
+		err = g.block(n)
+	case *blade.ComponentNode:
+		err = g.component(n)
+	default:
+		err = fmt.Errorf("unsupported node %T", n)
+	}
+	if err == nil && g.exprErr != nil {
+		err, g.exprErr = g.exprErr, nil
+	}
+	return err
+}
+
+// braceBreak separates braces in literal text: an empty comment action
+// whose trim marker removes the space before it. It writes nothing, so
+// "{{" in the source comes out as "{{" in any escaping context.
+const braceBreak = " {{- /**/}}"
+
+// text writes literal markup. Text never holds an action, but @verbatim
+// blocks and @{{ escapes can bring in "{{" and "}}", and a trailing "{"
+// would run into the next action, so braces are broken up with braceBreak
+// and the compiled template keeps exactly the actions the codegen wrote.
+func (g *codegen) text(n *blade.TextNode) {
+	s, start := n.Text, 0
+	loc := g.loc(n.Pos)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '{' && (i+1 == len(s) || s[i+1] == '{') || c == '}' && i+1 < len(s) && s[i+1] == '}' {
+			g.out.write(s[start:i+1], loc, true)
+			loc.Line, loc.Col = advance(loc.Line, loc.Col, s[start:i+1])
+			g.out.write(braceBreak, loc, false)
+			start = i + 1
+		}
+	}
+	g.out.write(s[start:], loc, true)
+}
+
+// literal writes the text of a quoted directive argument, such as the
+// default of @yield('title', 'Home'), with its braces broken up like text.
+func (g *codegen) literal(pos blade.Pos, s string) {
+	g.text(&blade.TextNode{Pos: pos, Text: s})
+}
+
+// inTag reports whether the output so far ends inside an HTML start tag,
+// as in <body class="@stack('classes')">.
+func (g *codegen) inTag() bool {
+	return openTagRe.MatchString(actionRe.ReplaceAllString(g.out.sb.String(), ""))
+}
+
+// capture runs fn with a fresh output buffer and returns what it wrote.
+func (g *codegen) capture(fn func() error) (*mappedText, error) {
+	saved := g.out
+	g.out = &mappedBuilder{}
+	defer func() { g.out = saved }()
+	if err := fn(); err != nil {
+		return nil, err
+	}
+	return g.out.mapped(), nil
+}
+
+// action writes a {{ }} action with optional trim markers.
+func (g *codegen) action(body string, trimLeft, trimRight bool) {
+	var sb strings.Builder
+	sb.WriteString("{{")
+	if trimLeft {
+		sb.WriteString("- ")
+	}
+	sb.WriteString(body)
+	if trimRight {
+		sb.WriteString(" -")
+	}
+	sb.WriteString("}}")
+	g.emit(sb.String())
+}
+
+func (g *codegen) pushScope(s *scope) {
+	if s.vars == nil {
+		s.vars = map[string]string{}
+	}
+	g.scopes = append(g.scopes, s)
+}
+
+func (g *codegen) popScope() {
+	if len(g.scopes) > 1 {
+		g.scopes = g.scopes[:len(g.scopes)-1]
+	}
+}
+
+// visible returns the scopes whose variables are in reach: those of the
+// innermost component body, or all of them outside components.
+func (g *codegen) visible() []*scope {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if g.scopes[i].isolated {
+			return g.scopes[i:]
+		}
+	}
+	return g.scopes
+}
+
+func (g *codegen) dotChanged() bool {
+	for _, s := range g.visible() {
+		if s.dotChanged {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveVar maps a Blade $name to a template reference: a loop binding, a
+// declared template variable, a component prop or a field of the root data.
+func (g *codegen) resolveVar(name string) string {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if ref, ok := g.scopes[i].vars[name]; ok {
+			return ref
+		}
+		if g.scopes[i].isolated {
+			g.checkDeclared(g.scopes[i], name)
+			return g.scopes[i].data + "." + name
+		}
+	}
+	g.checkDeclared(g.scopes[0], name)
+	if g.dotChanged() {
+		return "$." + name
+	}
+	return "." + name
+}
+
+// checkDeclared records an error in strict mode when name is not declared
+// by the template whose root scope is s.
+func (g *codegen) checkDeclared(s *scope, name string) {
+	if s.declared[name] || g.exprErr != nil || !g.c.isStrict() {
+		return
+	}
+	g.exprErr = g.errorf(g.cur, "undeclared variable $%s; declare it with @props(['%s'])", name, name)
+}
+
+// declaredProps returns the names declared by the top-level @props of doc.
+func declaredProps(doc *blade.Document) map[string]bool {
+	names := map[string]bool{}
+	for _, node := range doc.Nodes {
+		d, ok := node.(*blade.DirectiveNode)
+		if !ok || d.Name != "props" {
+			continue
+		}
+		entries, _ := arrayEntries(d.Args)
+		for _, e := range entries {
+			if e[0] == "" {
+				names[blade.Unquote(e[1])] = true
+			} else {
+				names[blade.Unquote(e[0])] = true
+			}
+		}
+	}
+	return names
+}
+
+// inBreakable reports whether @break and @continue are valid here.
+func (g *codegen) inBreakable() bool {
+	for _, s := range g.visible() {
+		if s.breakable {
+			return true
+		}
+	}
+	return false
+}
+
+// inLoop reports whether a @foreach body is open, so $loop is declared.
+func (g *codegen) inLoop() bool {
+	for _, s := range g.visible() {
+		if s.loop {
+			return true
+		}
+	}
+	return false
+}
+
+// expr rewrites a Blade expression into a template expression. It is
+// parsed by the expr package, so operators, $m["key"] indexing and method
+// calls are lowered and string literals are left alone. Pipeline filters
+// must be registered functions. An invalid expression is recorded in
+// exprErr and reported once the node is done.
+func (g *codegen) expr(raw string) string {
+	e, err := expr.NewParser(raw).Funcs(g.c.hasFunc).Parse()
+	if err == nil {
+		var out string
+		if out, err = expr.LowerWithRoot(e, g.resolveVar, g.c.takesRoot); err == nil {
+			return out
+		}
+	}
+	if g.exprErr == nil {
+		loc := g.loc(g.cur)
+		if serr, ok := err.(*expr.SyntaxError); ok {
+			loc = g.exprLoc(raw, serr.Pos)
+		}
+		g.exprErr = &TemplateError{Template: g.file, Location: loc, Message: "invalid expression: " + err.Error(), Err: err}
+	}
+	return raw
+}
+
+// exprLoc returns the source location of pos in the expression raw, which
+// is the first occurrence of raw from the current node on, or the node's
+// own location when raw is not found there.
+func (g *codegen) exprLoc(raw string, pos expr.Pos) SourceLocation {
+	if g.cur.Offset > len(g.src) {
+		return g.loc(g.cur)
+	}
+	i := strings.Index(g.src[g.cur.Offset:], raw)
+	if i < 0 {
+		return g.loc(g.cur)
+	}
+	return g.loc(blade.NewLexer(g.src, nil).PosFor(g.cur.Offset + i + pos.Offset))
+}
+
+// vars rewrites the Blade $variables of native template text in place.
+func (g *codegen) vars(text string) string {
+	return dollarVarRe.ReplaceAllStringFunc(text, func(m string) string {
+		sub := dollarVarRe.FindStringSubmatch(m)
+		return g.resolveVar(sub[1]) + sub[2]
+	})
+}
+
+// actionExpr rewrites the text of a native action. The pipeline of if,
+// else if and with is an expression; declarations, range and template
+// calls only get their $variables rewritten.
+func (g *codegen) actionExpr(text string) string {
+	for _, kw := range []string{"if ", "else if ", "with ", "else with "} {
+		if rest, ok := strings.CutPrefix(text, kw); ok && !goDeclRe.MatchString(rest) {
+			return kw + g.expr(rest)
+		}
+	}
+	return g.vars(text)
+}
+
+// echo emits {{ expr }} escaped and {!! expr !!} raw. An echo that already
+// calls raw is Go template syntax and is passed through unchanged.
+func (g *codegen) echo(n *blade.EchoNode) {
+	if slot := g.slot(n.Expr); slot != nil {
+		g.out.writeMapped(slot)
+		return
+	}
+	e := g.expr(n.Expr)
+	switch {
+	case n.Raw:
+		g.action("raw "+operand(e), n.TrimLeft, n.TrimRight)
+	case firstWord(e) == "raw":
+		g.action(e, n.TrimLeft, n.TrimRight)
+	default:
+		g.action("escape "+operand(e), n.TrimLeft, n.TrimRight)
+	}
+}
+
+// goAction passes a native template action through, tracking the variables
+// and dot changes it introduces so Blade $vars inside resolve correctly.
+func (g *codegen) goAction(n *blade.ActionNode) {
+	word := firstWord(n.Text)
+	if word == "end" {
+		if g.scopes[len(g.scopes)-1].goAction {
+			g.popScope()
+		}
+		g.action(n.Text, n.TrimLeft, n.TrimRight)
+		return
+	}
+	switch word {
+	case "if", "range", "with", "define", "block":
+		g.pushScope(&scope{goAction: true, dotChanged: word == "range" || word == "with", breakable: word == "range"})
+	}
+	top := g.scopes[len(g.scopes)-1]
+	for _, m := range goDeclRe.FindAllStringSubmatch(n.Text, -1) {
+		for _, v := range m[1:] {
+			if v != "" {
+				top.vars[v] = "$" + v
+			}
+		}
+	}
+	g.action(g.actionExpr(n.Text), n.TrimLeft, n.TrimRight)
+}
+
+// directive emits a standalone directive.
+func (g *codegen) directive(n *blade.DirectiveNode) error {
+	switch n.Name {
+	case "extends":
+		// handled by processExtends
+		return nil
+	case "php", "props":
+		// @props is read when the component is expanded; in pages and
+		// views it declares the data names for strict mode
+		return nil
+	case "yield":
+		// a block renders the section when defined and the default otherwise
+		args := blade.SplitArgs(n.Args)
+		name := g.firstArgName(n.Args)
+		if name == "" {
+			return g.errorf(n.Pos, "@yield requires a section name")
+		}
+		g.emit(fmt.Sprintf("{{block %q .}}", name))
+		if len(args) > 1 {
+			if v := args[1]; isQuoted(v) {
+				g.literal(n.Pos, template.HTMLEscapeString(blade.Unquote(v)))
+			} else {
+				g.action("escape "+operand(g.expr(v)), false, false)
+			}
+		}
+		g.emit("{{end}}")
+		return nil
+	case "class", "style", "attr", "checked", "selected", "disabled", "readonly", "required", "json", "js":
+		return g.htmlDirective(n)
+	case "flush":
+		g.flushes = true
+		g.action("flushMark", false, false)
+		return nil
+	case "csrf":
+		g.action("csrfInput $", false, false)
+		return nil
+	case "method":
+		if strings.TrimSpace(n.Args) == "" {
+			return g.errorf(n.Pos, "@method requires an HTTP method")
+		}
+		g.action("methodInput "+g.value(n.Args), false, false)
+		return nil
+	case "stack":
+		name := g.firstArgName(n.Args)
+		if !stackNameRe.MatchString(name) {
+			return g.errorf(n.Pos, "invalid stack name %q", name)
+		}
+		// the stack is filled in from a marker comment, which html/template
+		// strips inside a tag, so the pushed content would be lost
+		if g.inTag() {
+			return g.errorf(n.Pos, "@stack(%q) cannot be used inside an HTML tag", name)
+		}
+		g.stacks = true
+		g.emit(fmt.Sprintf("{{stackMark \"stack\" %q \"\"}}", name))
+		return nil
+	case "push", "prepend":
+		// inline form: @push('scripts', '<script src="x.js"></script>')
+		args := blade.SplitArgs(n.Args)
+		return g.push(n.Pos, n.Name, args, nil, func() error {
+			if v := args[1]; isQuoted(v) {
+				g.literal(n.Pos, blade.Unquote(v))
+			} else {
+				g.action("escape "+operand(g.expr(v)), false, false)
+			}
+			return nil
+		})
+	case "parent":
+		// replaced by the parent layout's content when sections are merged
+		g.emit(parentMarker)
+		return nil
+	case "include", "includeIf", "includeWhen", "includeUnless", "includeFirst":
+		return g.include(n)
+	case "each":
+		return g.each(n)
+	case "break", "continue":
+		return g.loopControl(n)
+	case "section":
+		args := blade.SplitArgs(n.Args)
+		name := blade.Unquote(args[0])
+		g.emit("{{define \"" + name + "\"}}")
+		if v := args[1]; isQuoted(v) {
+			g.literal(n.Pos, template.HTMLEscapeString(blade.Unquote(v)))
+		} else {
+			g.action("escape "+operand(g.expr(v)), false, false)
+		}
+		g.emit("{{end}}")
+		return nil
+	}
+	if fn, ok := g.c.customDirective(n.Name); ok {
+		return g.customDirective(n, fn)
+	}
+	return g.errorf(n.Pos, "unsupported directive @%s", n.Name)
+}
+
+// block emits a directive with a body.
+func (g *codegen) block(n *blade.BlockNode) error {
+	switch n.Name {
+	case "if", "unless":
+		if !n.HasArgs || strings.TrimSpace(n.Args) == "" {
+			return g.errorf(n.Pos, "@%s requires a condition", n.Name)
+		}
+		cond := g.expr(n.Args)
+		if n.Name == "unless" {
+			cond = "not " + operand(cond)
+		}
+		return g.ifBlock(n, cond, nil)
+	case "hasSection", "sectionMissing":
+		name := g.firstArgName(n.Args)
+		if name == "" {
+			return g.errorf(n.Pos, "@%s requires a section name", n.Name)
+		}
+		// resolved to true or false once the layout chain is merged
+		cond := fmt.Sprintf("hasSection %q", name)
+		if n.Name == "sectionMissing" {
+			cond = "not (" + cond + ")"
+		}
+		return g.ifBlock(n, cond, nil)
+	case "foreach", "forelse":
+		return g.foreach(n)
+	case "for":
+		return g.forBlock(n)
+	case "while":
+		return g.whileBlock(n)
+	case "section":
+		return g.section(n)
+	case "push", "prepend", "pushOnce", "prependOnce":
+		return g.push(n.Pos, n.Name, blade.SplitArgs(n.Args), n, func() error { return g.nodes(n.Body) })
+	case "php":
+		return nil
+	case "error":
+		return g.errorBlock(n)
+	case "fragment":
+		return g.fragment(n)
+	}
+	if name, negate, ok := g.c.customCondition(n.Name); ok {
+		return g.customIf(n, name, negate)
+	}
+	if authDirectives[n.Name] {
+		return g.authBlock(n)
+	}
+	return g.errorf(n.Pos, "unsupported block @%s", n.Name)
+}
+
+// authDirectives are the authorization blocks, checked with the
+// Authorizer set by SetAuthorizer.
+var authDirectives = map[string]bool{"auth": true, "guest": true, "can": true, "cannot": true, "role": true}
+
+// authBlock emits @auth, @guest, @can, @cannot and @role as conditions on
+// the AuthContext of the root data: @can('edit', $post) is
+// {{if authCan $ "edit" .post}}.
+func (g *codegen) authBlock(n *blade.BlockNode) error {
+	switch n.Name {
+	case "auth", "guest":
+		if strings.TrimSpace(n.Args) != "" {
+			return g.errorf(n.Pos, "@%s takes no arguments", n.Name)
+		}
+		cond := "authCheck $"
+		if n.Name == "guest" {
+			cond = "not (authCheck $)"
+		}
+		return g.ifBlock(n, cond, nil)
+	}
+	fn := "authCan"
+	if n.Name == "role" {
+		fn = "authRole"
+	}
+	cond := func(args string) string {
+		s := fn + " $"
+		for _, a := range blade.SplitArgs(args) {
+			if a != "" {
+				s += " " + g.value(a)
+			}
+		}
+		if n.Name == "cannot" {
+			s = "not (" + s + ")"
+		}
+		return s
+	}
+	if strings.TrimSpace(n.Args) == "" {
+		return g.errorf(n.Pos, "@%s requires an argument", n.Name)
+	}
+	return g.ifBlock(n, cond(n.Args), cond)
+}
+
+// errorBlock emits @error('field') ... @enderror, shown when the field
+// has a validation error; the body reads the first message as $message.
+func (g *codegen) errorBlock(n *blade.BlockNode) error {
+	args := blade.SplitArgs(n.Args)
+	if len(args) == 0 || args[0] == "" {
+		return g.errorf(n.Pos, "@error requires a field name")
+	}
+	g.seq++
+	msg := fmt.Sprintf("$__e%d", g.seq)
+	g.emit(fmt.Sprintf("{{%s := formError $ %s}}", msg, g.value(args[0])))
+	g.pushScope(&scope{vars: map[string]string{"message": msg}})
+	defer g.popScope()
+	return g.ifBlock(n, msg, nil)
+}
+
+// ifBlock emits @if/@elseif/@else/@endif, @unless/@else/@endunless, the
+// section checks and custom conditionals with the given condition. elseIf
+// builds the condition of an else-if clause; nil means a Blade expression.
+func (g *codegen) ifBlock(n *blade.BlockNode, cond string, elseIf func(args string) string) error {
+	if elseIf == nil {
+		elseIf = g.expr
+	}
+	g.emit("{{if " + cond + "}}")
+	if err := g.nodes(n.Body); err != nil {
+		return err
+	}
+	for i, cl := range n.Clauses {
+		g.at(cl.Pos)
+		if i > 0 && n.Clauses[i-1].Name == "else" {
+			return g.errorf(cl.Pos, "@%s after @else in @%s opened at %s", cl.Name, n.Name, n.Pos)
+		}
+		switch cl.Name {
+		case "else":
+			g.emit("{{else}}")
+		default:
+			if cl.Name == "elseif" && (!cl.HasArgs || strings.TrimSpace(cl.Args) == "") {
+				return g.errorf(cl.Pos, "@elseif requires a condition")
+			}
+			g.emit("{{else if " + elseIf(cl.Args) + "}}")
+		}
+		if err := g.nodes(cl.Body); err != nil {
+			return err
+		}
+	}
+	g.at(n.EndPos)
+	g.emit("{{end}}")
+	return nil
+}
+
+// foreach emits @foreach($items as $item), @foreach($items as $key => $value)
+// and @forelse ... @empty ... @endforelse. The collection is flattened by
+// loopOver so every iteration can declare $loop; the item and key become
+// template variables, keeping outer loop variables reachable in the body.
+func (g *codegen) foreach(n *blade.BlockNode) error {
+	m := foreachRe.FindStringSubmatch(strings.TrimSpace(n.Args))
+	if m == nil {
+		return g.errorf(n.Pos, "invalid @%s header %q, expected \"$items as $item\" or \"$items as $key => $value\"", n.Name, n.Args)
+	}
+	coll := g.expr(strings.TrimSpace(m[1]))
+	key, item := m[2], m[3]
+	parent := "nil"
+	if g.inLoop() {
+		parent = "$loop"
+	}
+	g.seq++
+	state := fmt.Sprintf("$__loop%d", g.seq)
+	idx := fmt.Sprintf("$__i%d", g.seq)
+	g.emit(fmt.Sprintf("{{%s := loopOver %s %s}}", state, operand(coll), parent))
+	g.emit(fmt.Sprintf("{{range %s, $%s := %s.Values}}", idx, item, state))
+	sc := &scope{vars: map[string]string{item: "$" + item, "loop": "$loop"}, dotChanged: true, loop: true, breakable: true}
+	if key != "" {
+		g.emit(fmt.Sprintf("{{$%s := index %s.Keys %s}}", key, state, idx))
+		sc.vars[key] = "$" + key
+	}
+	g.emit(fmt.Sprintf("{{$loop := %s.At %s}}", state, idx))
+	g.pushScope(sc)
+	err := g.nodes(n.Body)
+	g.popScope()
+	if err != nil {
+		return err
+	}
+	for i, cl := range n.Clauses {
+		g.at(cl.Pos)
+		if i > 0 {
+			return g.errorf(cl.Pos, "duplicate @%s in @%s opened at %s", cl.Name, n.Name, n.Pos)
+		}
+		g.emit("{{else}}")
+		if err := g.nodes(cl.Body); err != nil {
+			return err
+		}
+	}
+	g.at(n.EndPos)
+	g.emit("{{end}}")
+	return nil
+}
+
+// forBlock emits @for($i = 0; $i < $n; $i++) as a range over forRange.
+func (g *codegen) forBlock(n *blade.BlockNode) error {
+	m := forRe.FindStringSubmatch(n.Args)
+	if m == nil {
+		return g.errorf(n.Pos, "invalid @for header %q, expected \"$i = 0; $i < $n; $i++\"", n.Args)
+	}
+	name, start, op, end := m[1], m[2], m[4], m[5]
+	stepVar, stepOp, step := m[6], m[7], m[8]
+	if stepVar == "" {
+		stepVar, stepOp = m[10], m[9]
+	}
+	if m[3] != name || stepVar != name {
+		return g.errorf(n.Pos, "@for header %q must use a single loop variable $%s", n.Args, name)
+	}
+	switch stepOp {
+	case "++":
+		step = "1"
+	case "--":
+		step = "-1"
+	case "+=":
+		step = operand(g.expr(step))
+	case "-=":
+		step = "(neg " + operand(g.expr(step)) + ")"
+	}
+	g.emit(fmt.Sprintf("{{range $%s := forRange %s %q %s %s}}", name, operand(g.expr(start)), op, operand(g.expr(end)), step))
+	g.pushScope(&scope{vars: map[string]string{name: "$" + name}, dotChanged: true, breakable: true})
+	err := g.nodes(n.Body)
+	g.popScope()
+	if err != nil {
+		return err
+	}
+	g.at(n.EndPos)
+	g.emit("{{end}}")
+	return nil
+}
+
+// whileBlock emits @while($cond) as an unbounded range that breaks once the
+// condition is false. whileGuard stops runaway loops with an error.
+func (g *codegen) whileBlock(n *blade.BlockNode) error {
+	if strings.TrimSpace(n.Args) == "" {
+		return g.errorf(n.Pos, "@while requires a condition")
+	}
+	// The condition is evaluated inside the range, where dot is the index.
+	g.pushScope(&scope{dotChanged: true, breakable: true})
+	cond := g.expr(n.Args)
+	g.seq++
+	idx := fmt.Sprintf("$__w%d", g.seq)
+	g.emit(fmt.Sprintf("{{range %s := whileLoop}}{{if not %s}}{{break}}{{end}}{{whileGuard %s}}", idx, operand(cond), idx))
+	err := g.nodes(n.Body)
+	g.popScope()
+	if err != nil {
+		return err
+	}
+	g.at(n.EndPos)
+	g.emit("{{end}}")
+	return nil
+}
+
+// loopControl emits @break, @continue and their conditional forms.
+func (g *codegen) loopControl(n *blade.DirectiveNode) error {
+	if !g.inBreakable() {
+		return g.errorf(n.Pos, "@%s outside of a loop", n.Name)
+	}
+	if strings.TrimSpace(n.Args) == "" {
+		g.emit("{{" + n.Name + "}}")
+		return nil
+	}
+	g.emit("{{if " + g.expr(n.Args) + "}}{{" + n.Name + "}}{{end}}")
+	return nil
+}
+
+// section emits @section('name') ... @endsection as a named template. A
+// section closed by @show is also output in place as a block, so children
+// can override it; @append keeps the parent's content before its own.
+func (g *codegen) section(n *blade.BlockNode) error {
+	name := g.firstArgName(n.Args)
+	if name == "" {
+		return g.errorf(n.Pos, "@section requires a name")
+	}
+	body, err := g.capture(func() error { return g.nodes(n.Body) })
+	if err != nil {
+		return err
+	}
+	g.at(n.Pos)
+	if n.End == "show" {
+		g.emit(fmt.Sprintf("{{block %q .}}", name))
+		g.out.writeMapped(body)
+		g.at(n.EndPos)
+		g.emit("{{end}}")
+		return nil
+	}
+	g.emit("{{define \"" + name + "\"}}")
+	if n.End == "append" {
+		g.emit(parentMarker)
+	}
+	g.out.writeMapped(body.trimSpace())
+	g.at(n.EndPos)
+	g.emit("{{end}}")
+	return nil
+}
+
+// push emits @push, @prepend, @pushOnce and @prependOnce: the content is
+// rendered in place between stack markers and moved into its @stack after
+// rendering. The once variants take an optional id, defaulting to the
+// directive's position, so content from a repeated include is pushed once.
+func (g *codegen) push(pos blade.Pos, directive string, args []string, n *blade.BlockNode, body func() error) error {
+	if len(args) == 0 {
+		return g.errorf(pos, "@%s requires a stack name", directive)
+	}
+	name := blade.Unquote(args[0])
+	if !stackNameRe.MatchString(name) {
+		return g.errorf(pos, "invalid stack name %q", name)
+	}
+	kind, once := strings.CutSuffix(directive, "Once")
+	id := ""
+	if once {
+		id = fmt.Sprintf("%s:%d:%d", g.file, pos.Line, pos.Col)
+		if len(args) > 1 {
+			id = blade.Unquote(args[1])
+		}
+		if !stackNameRe.MatchString(id) {
+			return g.errorf(pos, "invalid @%s id %q", directive, id)
+		}
+	}
+	g.stacks = true
+	g.emit(fmt.Sprintf("{{stackMark %q %q %q}}", kind, name, id))
+	if err := body(); err != nil {
+		return err
+	}
+	if n != nil {
+		g.at(n.EndPos)
+	}
+	g.emit("{{stackMark \"end\" \"\" \"\"}}")
+	return nil
+}
+
+// includePrefix names the templates generated for included views.
+const includePrefix = "include:"
+
+// resolveView finds an included view under the templates directory. Names
+// may be given with or without the .blade.tpl extension, or in dot notation
+// (components.card).
+func (g *codegen) resolveView(name string) (string, bool) {
+	candidates := []string{name, name + ".blade.tpl"}
+	if !strings.ContainsAny(name, "/\\") {
+		candidates = append(candidates, strings.ReplaceAll(name, ".", "/")+".blade.tpl")
+	}
+	for _, rel := range candidates {
+		if info, err := os.Stat(filepath.Join(g.c.templatesDir, filepath.FromSlash(rel))); err == nil && !info.IsDir() {
+			return filepath.ToSlash(rel), true
+		}
+	}
+	return "", false
+}
+
+// view generates an included view once as {{define "include:rel"}}, hoisted
+// to the end of the output, and returns the template name. Its body runs in
+// a fresh scope: the dot is the data map built by includeData.
+func (g *codegen) view(rel string) (string, error) {
+	name := includePrefix + rel
+	if _, done := g.defines[name]; done {
+		return name, nil
+	}
+	path := filepath.Join(g.c.templatesDir, filepath.FromSlash(rel))
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading template %s: %w", path, err)
+	}
+	file := g.c.sourceName(path)
+	doc, err := blade.Parse(string(content), g.c.currentSyntax())
+	if err != nil {
+		return "", g.c.blameSource(file, err)
+	}
+	// register first so a view that includes itself terminates
+	g.defines[name] = nil
+	g.defineOrder = append(g.defineOrder, name)
+
+	savedFile, savedSrc, savedScopes, savedCur := g.file, g.src, g.scopes, g.cur
+	g.file, g.src, g.scopes = file, string(content), nil
+	g.pushScope(&scope{declared: declaredProps(doc)})
+	body, err := g.capture(func() error { return g.nodes(doc.Nodes) })
+	g.file, g.src, g.scopes, g.cur = savedFile, savedSrc, savedScopes, savedCur
+	if err != nil {
+		return "", err
+	}
+	g.defines[name] = body
+	return name, nil
+}
+
+// fragmentPrefix starts the template names of @fragment blocks.
+const fragmentPrefix = "fragment:"
+
+// fragment emits @fragment('name') ... @endfragment. The body is generated
+// once as {{define "fragment:name"}}, hoisted like an included view so
+// BladeEngine.RenderFragment can execute it alone, and called in place.
+// It runs in a fresh scope whose data is the enclosing data plus the
+// variables in scope, such as the item of a surrounding @foreach; a
+// fragment rendered alone reads them from the data it is given.
+func (g *codegen) fragment(n *blade.BlockNode) error {
+	name := g.firstArgName(n.Args)
+	if name == "" {
+		return g.errorf(n.Pos, "@fragment requires a name")
+	}
+	tmplName := fragmentPrefix + name
+	if _, dup := g.defines[tmplName]; dup {
+		return g.errorf(n.Pos, "fragment %q is defined twice", name)
+	}
+	g.defines[tmplName] = nil
+	g.defineOrder = append(g.defineOrder, tmplName)
+
+	// variables in scope, innermost first, up to a component body
+	base, declared := "$", map[string]bool{}
+	var params []string
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		s := g.scopes[i]
+		names := make([]string, 0, len(s.vars))
+		for v := range s.vars {
+			names = append(names, v)
+		}
+		sort.Strings(names)
+		for _, v := range names {
+			if !declared[v] {
+				declared[v] = true
+				params = append(params, strconv.Quote(v), s.vars[v])
+			}
+		}
+		if s.isolated || i == 0 {
+			for v := range s.declared {
+				declared[v] = true
+			}
+			if s.isolated {
+				base = s.data
+			}
+			break
+		}
+	}
+
+	savedScopes := g.scopes
+	g.scopes = nil
+	g.pushScope(&scope{declared: declared})
+	body, err := g.capture(func() error { return g.nodes(n.Body) })
+	g.scopes = savedScopes
+	if err != nil {
+		return err
+	}
+	g.defines[tmplName] = body
+	g.at(n.Pos)
+	g.emit(fmt.Sprintf("{{template %q (includeData %s (dict%s))}}", tmplName, base, joinArgs(params)))
+	return nil
+}
+
+// includeCall emits a call of an included view with the parent data merged
+// with the optional ['key' => $value] array.
+func (g *codegen) includeCall(pos blade.Pos, rel, data string) error {
+	params, err := g.array(pos, data)
+	if err != nil {
+		return err
+	}
+	name, err := g.view(rel)
+	if err != nil {
+		return err
+	}
+	g.at(pos)
+	g.emit(fmt.Sprintf("{{template %q (includeData $ %s)}}", name, params))
+	return nil
+}
+
+// include emits @include, @includeIf, @includeWhen, @includeUnless and
+// @includeFirst.
+func (g *codegen) include(n *blade.DirectiveNode) error {
+	args := blade.SplitArgs(n.Args)
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	switch n.Name {
+	case "include", "includeIf":
+		name := blade.Unquote(arg(0))
+		if name == "" {
+			return g.errorf(n.Pos, "@%s requires a template name", n.Name)
+		}
+		rel, ok := g.resolveView(name)
+		if !ok {
+			if n.Name == "includeIf" {
+				return nil
+			}
+			return g.errorf(n.Pos, "included template not found: %s", name)
+		}
+		return g.includeCall(n.Pos, rel, arg(1))
+	case "includeWhen", "includeUnless":
+		if len(args) < 2 {
+			return g.errorf(n.Pos, "@%s requires a condition and a template name", n.Name)
+		}
+		name := blade.Unquote(arg(1))
+		rel, ok := g.resolveView(name)
+		if !ok {
+			return g.errorf(n.Pos, "included template not found: %s", name)
+		}
+		cond := g.expr(arg(0))
+		if n.Name == "includeUnless" {
+			cond = "not " + operand(cond)
+		}
+		g.emit("{{if " + cond + "}}")
+		if err := g.includeCall(n.Pos, rel, arg(2)); err != nil {
+			return err
+		}
+		g.emit("{{end}}")
+		return nil
+	case "includeFirst":
+		entries, ok := arrayEntries(arg(0))
+		if !ok {
+			return g.errorf(n.Pos, "@includeFirst expects an array of template names, got %q", arg(0))
+		}
+		var tried []string
+		for _, e := range entries {
+			name := blade.Unquote(e[1])
+			if rel, ok := g.resolveView(name); ok {
+				return g.includeCall(n.Pos, rel, arg(1))
+			}
+			tried = append(tried, name)
+		}
+		return g.errorf(n.Pos, "none of the templates given to @includeFirst exist: %s", strings.Join(tried, ", "))
+	}
+	return g.errorf(n.Pos, "unsupported directive @%s", n.Name)
+}
+
+// each emits @each('view', $items, 'item', 'empty-view'): the view is
+// rendered once per element with the element bound to the given name and
+// its index as key. The optional fourth argument is a view rendered for an
+// empty collection, or literal text when prefixed with raw|.
+func (g *codegen) each(n *blade.DirectiveNode) error {
+	args := blade.SplitArgs(n.Args)
+	if len(args) < 3 {
+		return g.errorf(n.Pos, "@each requires a view, a collection and a variable name")
+	}
+	name := blade.Unquote(args[0])
+	rel, ok := g.resolveView(name)
+	if !ok {
+		return g.errorf(n.Pos, "included template not found: %s", name)
+	}
+	tmpl, err := g.view(rel)
+	if err != nil {
+		return err
+	}
+	item := strings.TrimPrefix(blade.Unquote(args[2]), "$")
+	g.seq++
+	key, val := fmt.Sprintf("$__k%d", g.seq), fmt.Sprintf("$__v%d", g.seq)
+	g.at(n.Pos)
+	g.emit(fmt.Sprintf("{{range %s, %s := %s}}{{template %q (includeData $ (dict %q %s \"key\" %s))}}", key, val, operand(g.expr(args[1])), tmpl, item, val, key))
+	if len(args) > 3 {
+		empty := blade.Unquote(args[3])
+		g.emit("{{else}}")
+		if text, ok := strings.CutPrefix(empty, "raw|"); ok {
+			g.literal(n.Pos, text)
+		} else {
+			rel, ok := g.resolveView(empty)
+			if !ok {
+				return g.errorf(n.Pos, "included template not found: %s", empty)
+			}
+			if err := g.includeCall(n.Pos, rel, ""); err != nil {
+				return err
+			}
+		}
+	}
+	g.emit("{{end}}")
+	return nil
+}
+
+// array converts a PHP-style ['key' => $value] array into a dict call. An
+// empty argument yields an empty dict.
+func (g *codegen) array(pos blade.Pos, list string) (string, error) {
+	if strings.TrimSpace(list) == "" {
+		return "(dict)", nil
+	}
+	entries, ok := arrayEntries(list)
+	if !ok {
+		return "", g.errorf(pos, "expected an array like ['key' => $value], got %q", list)
+	}
+	var args []string
+	for _, e := range entries {
+		if e[0] == "" {
+			return "", g.errorf(pos, "array entry %q needs a key", e[1])
+		}
+		args = append(args, strconv.Quote(blade.Unquote(e[0])), g.value(e[1]))
+	}
+	return "(dict" + joinArgs(args) + ")", nil
+}
+
+// htmlDirective emits the directives that write HTML attributes or embed
+// data in a context html/template escapes: @class, @style, @attr, the
+// boolean attributes @checked, @selected, @disabled, @readonly and
+// @required, and @json and @js.
+func (g *codegen) htmlDirective(n *blade.DirectiveNode) error {
+	if strings.TrimSpace(n.Args) == "" {
+		return g.errorf(n.Pos, "@%s requires an argument", n.Name)
+	}
+	switch n.Name {
+	case "class", "style", "attr":
+		return g.attrList(n)
+	case "json":
+		g.action("json "+operand(g.expr(n.Args)), false, false)
+	case "js":
+		g.action("jsFrom "+operand(g.expr(n.Args)), false, false)
+	default:
+		g.emit("{{if " + g.expr(n.Args) + "}}" + n.Name + "{{end}}")
+	}
+	return nil
+}
+
+// attrFuncs names the function rendering each attribute directive.
+var attrFuncs = map[string]string{"class": "classAttr", "style": "styleAttr", "attr": "attrs"}
+
+// attrList emits @class, @style and @attr. The entries of the array
+// argument become name/value pairs in order; a list entry such as 'btn' is
+// its own name with the value true.
+func (g *codegen) attrList(n *blade.DirectiveNode) error {
+	entries, ok := arrayEntries(n.Args)
+	if !ok {
+		return g.errorf(n.Pos, "@%s expects an array, got %q", n.Name, n.Args)
+	}
+	var args []string
+	for _, e := range entries {
+		if e[0] == "" {
+			args = append(args, g.value(e[1]), "true")
+		} else {
+			args = append(args, g.value(e[0]), g.value(e[1]))
+		}
+	}
+	g.action(attrFuncs[n.Name]+joinArgs(args), false, false)
+	return nil
+}
+
+// value converts a PHP-style literal or Blade expression into an operand.
+func (g *codegen) value(v string) string {
+	switch {
+	case isQuoted(v):
+		return strconv.Quote(blade.Unquote(v))
+	case v == "null":
+		return "nil"
+	}
+	return operand(g.expr(v))
+}
+
+// arrayEntries splits a PHP-style array literal ['a' => 1, 'b'] into
+// key/value pairs; the key is empty for list entries.
+func arrayEntries(list string) ([][2]string, bool) {
+	list = strings.TrimSpace(list)
+	if !strings.HasPrefix(list, "[") || !strings.HasSuffix(list, "]") {
+		return nil, false
+	}
+	var out [][2]string
+	for _, entry := range blade.SplitArgs(list[1 : len(list)-1]) {
+		if entry == "" {
+			continue
+		}
+		if i := strings.Index(entry, "=>"); i >= 0 {
+			out = append(out, [2]string{strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+2:])})
+		} else {
+			out = append(out, [2]string{"", entry})
+		}
+	}
+	return out, true
+}
+
+// component expands <x-name attr="..." :bound="$expr">...</x-name> inline.
+// The tag resolves to components/name.blade.tpl (dots become directories).
+// Its attributes and filled slots are gathered into a data variable by the
+// component helper; the body is generated in an isolated scope where props,
+// $attributes and slot flags resolve against that variable, and echoing a
+// slot writes the caller's slot content in place.
+func (g *codegen) component(n *blade.ComponentNode) error {
+	if n.Name == "slot" {
+		return g.errorf(n.Pos, "<x-slot:%s> outside of a component", n.Slot)
+	}
+	rel := "components/" + strings.ReplaceAll(n.Name, ".", "/") + ".blade.tpl"
+	path := filepath.Join(g.c.templatesDir, filepath.FromSlash(rel))
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return g.errorf(n.Pos, "component <x-%s> not found: %s", n.Name, rel)
+	}
+	for _, c := range g.components {
+		if c == rel {
+			return g.errorf(n.Pos, "component <x-%s> includes itself", n.Name)
+		}
+	}
+	file := g.c.sourceName(path)
+	doc, err := blade.Parse(string(content), g.c.currentSyntax())
+	if err != nil {
+		return g.c.blameSource(file, err)
+	}
+
+	// caller side: attributes and slots are generated in the caller's scope;
+	// slot content is later placed inside the component body, where the dot
+	// may have changed, so it refers to root data through $.
+	var attrs []string
+	for _, a := range n.Attrs {
+		switch {
+		case a.Bound:
+			attrs = append(attrs, strconv.Quote(a.Name), operand(g.expr(a.Value)))
+		case a.HasValue:
+			attrs = append(attrs, strconv.Quote(a.Name), strconv.Quote(a.Value))
+		default:
+			attrs = append(attrs, strconv.Quote(a.Name), "true")
+		}
+	}
+	slots := map[string]*mappedText{}
+	var defaultSlot []blade.Node
+	for _, child := range n.Body {
+		if sn, ok := child.(*blade.ComponentNode); ok && sn.Name == "slot" {
+			if _, dup := slots[sn.Slot]; dup {
+				return g.errorf(sn.Pos, "duplicate <x-slot:%s>", sn.Slot)
+			}
+			content, err := g.slotContent(sn.Body)
+			if err != nil {
+				return err
+			}
+			slots[sn.Slot] = content
+			continue
+		}
+		defaultSlot = append(defaultSlot, child)
+	}
+	body, err := g.slotContent(defaultSlot)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(body.Text) != "" {
+		slots["slot"] = body
+	}
+	names := make([]string, 0, len(slots))
+	for name := range slots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var filled []string
+	for _, name := range names {
+		filled = append(filled, strconv.Quote(name), "true")
+	}
+
+	props, err := g.props(doc, file)
+	if err != nil {
+		return err
+	}
+
+	g.seq++
+	data := fmt.Sprintf("$__c%d", g.seq)
+	g.at(n.Pos)
+	g.emit(fmt.Sprintf("{{%s := component (dict%s) (dict%s) (dict%s)}}", data, joinArgs(props), joinArgs(attrs), joinArgs(filled)))
+
+	// component side
+	savedFile, savedSrc := g.file, g.src
+	g.file, g.src = file, string(content)
+	g.components = append(g.components, rel)
+	declared := declaredProps(doc)
+	declared["attributes"], declared["slot"] = true, true
+	for name := range slots {
+		declared[name] = true
+	}
+	g.pushScope(&scope{isolated: true, data: data, slots: slots, declared: declared})
+	err = g.nodes(doc.Nodes)
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	g.components = g.components[:len(g.components)-1]
+	g.file, g.src = savedFile, savedSrc
+	return err
+}
+
+// slotContent generates slot markup in the caller's scope with root data
+// referenced through $.
+func (g *codegen) slotContent(nodes []blade.Node) (*mappedText, error) {
+	g.pushScope(&scope{dotChanged: true})
+	defer g.popScope()
+	return g.capture(func() error { return g.nodes(nodes) })
+}
+
+// slot returns the caller's content for an echo of a filled slot variable
+// inside a component body, e.g. {{ $slot }} or {!! $footer !!}.
+func (g *codegen) slot(expr string) *mappedText {
+	m := slotEchoRe.FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return nil
+	}
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		s := g.scopes[i]
+		if _, ok := s.vars[m[1]]; ok {
+			return nil
+		}
+		if s.isolated {
+			return s.slots[m[1]]
+		}
+	}
+	return nil
+}
+
+// props reads the @props([...]) declaration of a component as name/default
+// argument pairs for dict. Entries without a default are declared as nil.
+func (g *codegen) props(doc *blade.Document, file string) ([]string, error) {
+	var out []string
+	for _, node := range doc.Nodes {
+		d, ok := node.(*blade.DirectiveNode)
+		if !ok || d.Name != "props" {
+			continue
+		}
+		entries, ok := arrayEntries(d.Args)
+		if !ok {
+			return nil, &TemplateError{Template: file, Location: SourceLocation{File: file, Line: d.Pos.Line, Col: d.Pos.Col},
+				Message: fmt.Sprintf("@props expects an array, got %q", d.Args)}
+		}
+		for _, e := range entries {
+			if e[0] == "" {
+				out = append(out, strconv.Quote(blade.Unquote(e[1])), "nil")
+			} else {
+				out = append(out, strconv.Quote(blade.Unquote(e[0])), g.value(e[1]))
+			}
+		}
+	}
+	return out, nil
+}
+
+// joinArgs renders function arguments with a leading space.
+func joinArgs(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return " " + strings.Join(args, " ")
+}
+
+func (g *codegen) firstArgName(args string) string {
+	parts := blade.SplitArgs(args)
+	if len(parts) == 0 {
+		return ""
+	}
+	return blade.Unquote(parts[0])
+}
+
+// operand wraps e in parentheses unless it is already a single operand.
+func operand(e string) string {
+	if isSingleOperand(e) {
+		return e
+	}
+	return "(" + e + ")"
+}
+
+// isSingleOperand reports whether e has no top-level spaces or pipes.
+func isSingleOperand(e string) bool {
+	depth := 0
+	for i := 0; i < len(e); i++ {
+		switch c := e[i]; c {
+		case '"', '\'', '`':
+			for j := i + 1; j < len(e); j++ {
+				if e[j] == '\\' && c != '`' {
+					j++
+					continue
+				}
+				if e[j] == c {
+					i = j
+					break
+				}
+			}
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ' ', '\t', '\n', '|':
+			if depth == 0 {
+				return false
+			}
+		}
+	}
+	return e != ""
+}
+
+func firstWord(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t\n("); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func isQuoted(s string) bool {
+	s = strings.TrimSpace(s)
+	return len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]
+}
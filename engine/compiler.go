@@ -2,6 +2,7 @@ package engine
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	fsys "io/fs"
@@ -9,9 +10,13 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	"blade_engine/engine/expr"
+	"blade_engine/engine/blade"
+	"blade_engine/engine/helpers"
 )
 
 type Compiler struct {
@@ -25,6 +30,25 @@ type Compiler struct {
 	// skipCompiledExtensions lists file extensions (including leading dot) for which
 	// the compiler should NOT write standalone compiled cache files.
 	skipCompiledExtensions []string
+	// syntax is the set of directives recognised by the Blade parser
+	syntax *blade.Syntax
+	// custom directives, conditionals and functions, see Directive, If and
+	// AddFuncs; extendedAt is the last registration, compiled cache files
+	// older than it are stale
+	extMu      sync.RWMutex
+	directives map[string]func(string) string
+	conditions map[string]func(...interface{}) bool
+	userFuncs  template.FuncMap
+	authorizer Authorizer
+	csrfKey    string // see SetCSRF
+	csrfField  string
+	extendedAt time.Time
+	// strict rejects undeclared $variables and parses templates with
+	// missingkey=error, see SetStrict
+	strict bool
+	// sourceMaps holds the latest compiled source map per template path
+	mapsMu     sync.RWMutex
+	sourceMaps map[string]*mappedText
 }
 
 func NewCompiler(templatesDir string) *Compiler {
@@ -64,11 +88,19 @@ func NewCompilerWithOptions(templatesDir, mode string, fs fsys.FS) *Compiler {
 		fs:           fs,
 		manifestPath: manifestPath,
 		funcMap: template.FuncMap{
-			"escape": func(s string) template.HTML {
-				return template.HTML(template.HTMLEscapeString(s))
+			"escape": func(v interface{}) interface{} {
+				switch v := v.(type) {
+				case *ComponentAttributes:
+					return v.HTMLAttr()
+				case template.HTML, template.JS:
+					// already safe, e.g. the result of nl2br, or JSON
+					// that html/template escapes for its context
+					return v
+				}
+				return template.HTML(template.HTMLEscapeString(stringify(v)))
 			},
-			"raw": func(s string) template.HTML {
-				return template.HTML(s)
+			"raw": func(v interface{}) template.HTML {
+				return template.HTML(stringify(v))
 			},
 			"isset": func(data interface{}, key string) bool {
 				if m, ok := data.(map[string]interface{}); ok {
@@ -77,12 +109,41 @@ func NewCompilerWithOptions(templatesDir, mode string, fs fsys.FS) *Compiler {
 				}
 				return false
 			},
+			"component":   component,
+			"dict":        dict,
+			"list":        list,
+			"classAttr":   classAttr,
+			"styleAttr":   styleAttr,
+			"attrs":       attrs,
+			"includeData": includeData,
+			"stackMark":   stackMark,
+			"flushMark":   flushMark,
+			"loopOver":    loopOver,
+			"forRange":    forRange,
+			"numRange":    numRange,
+			"whileLoop":   whileLoop,
+			"whileGuard":  whileGuard,
+			"neg":         neg,
 			// join: helper for tests that join []string with a separator
 			"join": func(sep string, items []string) string {
 				return strings.Join(items, sep)
 			},
 		},
 		skipCompiledExtensions: skipList,
+		syntax:                 blade.DefaultSyntax(),
+	}
+	// customIf reads the conditionals registered with If, authCan and
+	// authRole the Authorizer and csrfInput the CSRF settings
+	c.funcMap["customIf"] = c.customIf
+	c.funcMap["authCheck"] = authCheck
+	c.funcMap["authCan"] = c.authCan
+	c.funcMap["authRole"] = c.authRole
+	c.funcMap["csrfInput"] = c.csrfInput
+	c.funcMap["methodInput"] = methodInput
+	c.funcMap["formError"] = formError
+	c.funcMap["old"] = old
+	for name, fn := range helpers.Funcs() {
+		c.funcMap[name] = fn
 	}
 
 	// ensure cache dir exists
@@ -99,6 +160,60 @@ func NewCompilerWithOptions(templatesDir, mode string, fs fsys.FS) *Compiler {
 	return c
 }
 
+// AddFuncs registers template functions for the templates compiled from
+// now on; a name already in use, built-in or not, is replaced. It panics
+// like template.Funcs if a value is not a suitable function.
+func (c *Compiler) AddFuncs(funcs template.FuncMap) {
+	if len(funcs) == 0 {
+		return
+	}
+	template.New("").Funcs(funcs)
+	c.extMu.Lock()
+	defer c.extMu.Unlock()
+	// copy on write, parses in flight keep the map they started with
+	m := make(template.FuncMap, len(c.funcMap)+len(funcs))
+	for k, v := range c.funcMap {
+		m[k] = v
+	}
+	if c.userFuncs == nil {
+		c.userFuncs = template.FuncMap{}
+	}
+	for k, v := range funcs {
+		m[k] = v
+		c.userFuncs[k] = v
+	}
+	c.funcMap = m
+	c.extendedAt = time.Now()
+}
+
+// funcs returns the functions available to compiled templates.
+func (c *Compiler) funcs() template.FuncMap {
+	c.extMu.RLock()
+	defer c.extMu.RUnlock()
+	return c.funcMap
+}
+
+// hasFunc reports whether name is in the function map.
+func (c *Compiler) hasFunc(name string) bool {
+	_, ok := c.funcs()[name]
+	return ok
+}
+
+// stringify renders a template value as text; nil (e.g. a missing map key) renders empty.
+func stringify(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case template.HTML:
+		return string(s)
+	case fmt.Stringer:
+		return s.String()
+	}
+	return fmt.Sprint(v)
+}
+
 // manifest helpers
 func (c *Compiler) loadManifest() error {
 	c.manifest = make(map[string]string)
@@ -146,6 +261,16 @@ func (c *Compiler) manifestFilenameForTemplate(templatePath string) string {
 
 // Compile biên dịch template từ Blade syntax sang Go template syntax
 func (c *Compiler) Compile(templatePath string) (string, error) {
+	compiled, err := c.compileFile(templatePath)
+	if err != nil {
+		return "", err
+	}
+	return compiled.Text, nil
+}
+
+// compileFile compiles a template file and records its source map so later
+// parse and execution errors can be reported against the original source.
+func (c *Compiler) compileFile(templatePath string) (*mappedText, error) {
 	// If in native Go mode, skip compiled file cache entirely: read and validate template then return
 	if c.mode == "go" {
 		var content []byte
@@ -157,13 +282,14 @@ func (c *Compiler) Compile(templatePath string) (string, error) {
 			content, err = os.ReadFile(templatePath)
 		}
 		if err != nil {
-			return "", fmt.Errorf("error reading template %s: %w", templatePath, err)
+			return nil, fmt.Errorf("error reading template %s: %w", templatePath, err)
 		}
-		// CompileString in go mode will validate and return the content unchanged
-		compiled, err := c.CompileString(string(content), templatePath)
+		// compileMapped in go mode will validate and return the content unchanged
+		compiled, err := c.compileMapped(string(content), templatePath)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
+		c.storeSourceMap(templatePath, compiled)
 		return compiled, nil
 	}
 	// For blade mode, we may or may not write compiled cache files.
@@ -178,10 +304,16 @@ func (c *Compiler) Compile(templatePath string) (string, error) {
 	if c.shouldWriteCompiled(templatePath) {
 		cacheInfo, cacheErr := os.Stat(cacheFile)
 		tplInfo, tplErr := os.Stat(templatePath)
-		if cacheErr == nil && tplErr == nil && cacheInfo.ModTime().After(tplInfo.ModTime()) {
+		if cacheErr == nil && tplErr == nil && cacheInfo.ModTime().After(tplInfo.ModTime()) && cacheInfo.ModTime().After(c.lastExtended()) {
 			compiled, err := os.ReadFile(cacheFile)
 			if err == nil {
-				return string(compiled), nil
+				mt := plainText(string(compiled))
+				// the source map is optional; without it errors point at compiled text
+				if data, err := os.ReadFile(cacheFile + ".map"); err == nil {
+					_ = json.Unmarshal(data, mt)
+				}
+				c.storeSourceMap(templatePath, mt)
+				return mt, nil
 			}
 		}
 	}
@@ -189,16 +321,20 @@ func (c *Compiler) Compile(templatePath string) (string, error) {
 	// Compile by reading from disk (blade mode)
 	content, err := os.ReadFile(templatePath)
 	if err != nil {
-		return "", fmt.Errorf("error reading template %s: %w", templatePath, err)
+		return nil, fmt.Errorf("error reading template %s: %w", templatePath, err)
 	}
-	compiled, err := c.CompileString(string(content), templatePath)
+	compiled, err := c.compileMapped(string(content), templatePath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	c.storeSourceMap(templatePath, compiled)
 
 	// Write compiled cache only for templates that need it
 	if c.shouldWriteCompiled(templatePath) {
-		if err := os.WriteFile(cacheFile, []byte(compiled), 0644); err == nil {
+		if err := os.WriteFile(cacheFile, []byte(compiled.Text), 0644); err == nil {
+			if data, err := json.Marshal(compiled); err == nil {
+				_ = os.WriteFile(cacheFile+".map", data, 0644)
+			}
 			// record mapping in manifest (use relative path key)
 			_ = c.registerCompiled(relPath, compiledName)
 		}
@@ -207,6 +343,35 @@ func (c *Compiler) Compile(templatePath string) (string, error) {
 	return compiled, nil
 }
 
+// sourceName returns the template name used in source locations: the path
+// relative to the templates directory, with forward slashes.
+func (c *Compiler) sourceName(templatePath string) string {
+	if rel, err := filepath.Rel(c.templatesDir, templatePath); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(templatePath)
+}
+
+// storeSourceMap remembers the most recent compilation of templatePath.
+func (c *Compiler) storeSourceMap(templatePath string, m *mappedText) {
+	c.mapsMu.Lock()
+	defer c.mapsMu.Unlock()
+	if c.sourceMaps == nil {
+		c.sourceMaps = make(map[string]*mappedText)
+	}
+	c.sourceMaps[templatePath] = m
+}
+
+// MapError rewrites an html/template parse or execution error for the
+// template at templatePath so it points at the original Blade source.
+// Errors that cannot be mapped are returned unchanged.
+func (c *Compiler) MapError(templatePath string, err error) error {
+	c.mapsMu.RLock()
+	m := c.sourceMaps[templatePath]
+	c.mapsMu.RUnlock()
+	return mapTemplateError(m, filepath.Base(templatePath), c.sourceName(templatePath), err)
+}
+
 // shouldWriteCompiled returns false for templates that shouldn't generate standalone compiled cache files
 func (c *Compiler) shouldWriteCompiled(templatePath string) bool {
 	rel, err := filepath.Rel(c.templatesDir, templatePath)
@@ -242,16 +407,51 @@ func (c *Compiler) SetSkipCompiledExtensions(exts []string) {
 	c.skipCompiledExtensions = cleaned
 }
 
+// SetStrict turns strict mode on or off. In strict mode a $variable read
+// from the template data must be declared with @props, and parsed templates
+// fail on missing map keys instead of rendering them empty. Compiled cache
+// files written before a change are compiled again.
+func (c *Compiler) SetStrict(strict bool) {
+	c.extMu.Lock()
+	defer c.extMu.Unlock()
+	if c.strict != strict {
+		c.strict = strict
+		c.extendedAt = time.Now()
+	}
+}
+
+// isStrict reports whether strict mode is on.
+func (c *Compiler) isStrict() bool {
+	c.extMu.RLock()
+	defer c.extMu.RUnlock()
+	return c.strict
+}
+
+// missingKey is the html/template missingkey option for parsed templates.
+func (c *Compiler) missingKey() string {
+	if c.isStrict() {
+		return "missingkey=error"
+	}
+	return "missingkey=default"
+}
+
 // processExtends processes the @extends directive
 func (c *Compiler) processExtends(content string) (string, string, error) {
-	re := regexp.MustCompile(`@extends\s*\(\s*'([^']+)'\s*\)`)
-	matches := re.FindStringSubmatch(content)
-
-	if len(matches) > 1 {
-		layout := matches[1]
-		// Remove extends directive from content
-		content = re.ReplaceAllString(content, "")
-		return strings.TrimSpace(content), layout, nil
+	toks, err := blade.NewLexer(content, c.currentSyntax().Known).Tokens()
+	if err != nil {
+		return "", "", err
+	}
+	for _, t := range toks {
+		if t.Typ != blade.TokDirective || t.Val != "extends" {
+			continue
+		}
+		args := blade.SplitArgs(t.Args)
+		if len(args) == 0 {
+			return "", "", fmt.Errorf("%d:%d: @extends requires a layout name", t.Pos.Line, t.Pos.Col)
+		}
+		// Remove extends directive from content; the rest keeps its line numbers
+		content = content[:t.Pos.Offset] + content[t.End:]
+		return content, blade.Unquote(args[0]), nil
 	}
 
 	return content, "", nil
@@ -259,572 +459,370 @@ func (c *Compiler) processExtends(content string) (string, string, error) {
 
 // CompileString compiles Blade-style content into Go template syntax
 func (c *Compiler) CompileString(content, templatePath string) (string, error) {
-	var err error
+	compiled, err := c.compileMapped(content, templatePath)
+	if err != nil {
+		return "", err
+	}
+	return compiled.Text, nil
+}
+
+// compileMapped is CompileString keeping the source map of the result.
+func (c *Compiler) compileMapped(content, templatePath string) (*mappedText, error) {
+	name := c.sourceName(templatePath)
 
 	// In native Go template mode, return content unchanged (no Blade transforms)
 	if c.mode == "go" {
+		compiled := verbatimText(content, name)
 		// Still validate template syntax for Go templates
 		if err := c.validateTemplateSyntax(content); err != nil {
-			return "", fmt.Errorf("invalid template syntax: %w", err)
+			return nil, fmt.Errorf("invalid template syntax: %w", mapTemplateError(compiled, validationName, name, err))
 		}
-		return content, nil
+		return compiled, nil
 	}
 
-	// Step 1: process extends
-	content, layout, err := c.processExtends(content)
+	// Step 1: find the layout; the directive itself is dropped by the code generator
+	_, layout, err := c.processExtends(content)
 	if err != nil {
-		return "", fmt.Errorf("error processing extends: %w", err)
+		return nil, fmt.Errorf("error processing extends: %w", c.blameSource(name, err))
 	}
 
 	// Step 2: process all directives
-	content, err = c.processAllDirectives(content, templatePath)
+	compiled, err := c.processAllDirectivesMapped(content, templatePath)
 	if err != nil {
-		return "", fmt.Errorf("error processing directives: %w", err)
+		return nil, fmt.Errorf("error processing directives: %w", err)
 	}
 
-	// Step 3: if layout provided, combine
+	// Step 3: if layout provided, combine; otherwise settle section checks
+	// against the template's own sections
 	if layout != "" {
-		content, err = c.combineWithLayout(content, layout)
+		compiled, err = c.combineWithLayoutMapped(compiled, layout)
 		if err != nil {
-			return "", fmt.Errorf("error combining with layout %s: %w", layout, err)
+			return nil, fmt.Errorf("error combining with layout %s: %w", layout, err)
 		}
-	}
-
-	// Step 4: validate template syntax
-	if err := c.validateTemplateSyntax(content); err != nil {
-		return "", fmt.Errorf("invalid template syntax: %w", err)
-	}
-
-	return content, nil
-}
-
-// processAllDirectives processes all Blade directives
-func (c *Compiler) processAllDirectives(content, templatePath string) (string, error) {
-	directives := []func(string, string) (string, error){
-		c.processSections,
-		c.processYield,
-		c.processInclude,
-		c.processIfStatements,
-		c.processElse,
-		c.processEndif,
-		c.processForeach,
-		c.processEndForeach,
-		c.processVariables,
-		c.processRawVariables,
-		c.processComments,
-		c.processPhp,
-		c.processUnless,
-	}
-
-	var err error
-	for _, directive := range directives {
-		content, err = directive(content, templatePath)
+	} else if strings.Contains(compiled.Text, "hasSection \"") {
+		defines, _, err := extractDefines(compiled)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
+		compiled = resolveSectionChecks(compiled, defines)
 	}
 
-	return content, nil
-}
-
-// processSections processes @section and @endsection directives
-func (c *Compiler) processSections(content, templatePath string) (string, error) {
-	// Handle @section('name') ... @endsection across multiple lines (use (?s) for dotall)
-	re := regexp.MustCompile(`(?s)@section\s*\(\s*['"]([^'"]+)['"]\s*\)\s*(.*?)\s*@endsection`)
-	content = re.ReplaceAllString(content, "{{define \"$1\"}}$2{{end}}")
-
-	// Handle @section('name') on single line
-	re = regexp.MustCompile(`@section\s*\(\s*['"]([^'"]+)['"]\s*\)\s*`)
-	content = re.ReplaceAllString(content, "{{define \"$1\"}}")
-
-	// Ensure no leftover @section/@endsection markers (we matched pairs above).
-	if strings.Contains(content, "@section") || strings.Contains(content, "@endsection") {
-		return "", fmt.Errorf("unclosed section in template %s", templatePath)
+	// Step 4: validate template syntax
+	if err := c.validateTemplateSyntax(compiled.Text); err != nil {
+		return nil, fmt.Errorf("invalid template syntax: %w", mapTemplateError(compiled, validationName, name, err))
 	}
 
-	return content, nil
+	return compiled, nil
 }
 
-// processYield processes @yield
-func (c *Compiler) processYield(content, templatePath string) (string, error) {
-	re := regexp.MustCompile(`@yield(?:\s*\(\s*)?(?:'([^']+)'|"([^"]+)"|([a-zA-Z0-9_\-/\.]+))(?:\s*\))?`)
-	content = re.ReplaceAllStringFunc(content, func(match string) string {
-		sub := re.FindStringSubmatch(match)
-		var name string
-		if sub[1] != "" {
-			name = sub[1]
-		} else if sub[2] != "" {
-			name = sub[2]
-		} else {
-			name = sub[3]
-		}
-		return "{{template \"" + name + "\" .}}"
-	})
-	return content, nil
-}
-
-// processInclude handles @include directives
-func (c *Compiler) processInclude(content, templatePath string) (string, error) {
-	re := regexp.MustCompile(`@include(?:\s*\(\s*)?(?:'([^']+)'|"([^\"]+)"|([a-zA-Z0-9_\-/\.]+))(?:\s*\))?`)
-	var includeErr error
-	content = re.ReplaceAllStringFunc(content, func(match string) string {
-		sub := re.FindStringSubmatch(match)
-		var componentName string
-		if len(sub) > 1 && sub[1] != "" {
-			componentName = sub[1]
-		} else if len(sub) > 2 && sub[2] != "" {
-			componentName = sub[2]
-		} else if len(sub) > 3 {
-			componentName = sub[3]
-		}
-		componentPath := filepath.Join(c.templatesDir, componentName)
-		if _, err := os.Stat(componentPath); os.IsNotExist(err) {
-			includeErr = fmt.Errorf("included template not found: %s", componentName)
-			return match
-		}
-		componentContent, err := c.Compile(componentPath)
-		if err != nil {
-			includeErr = fmt.Errorf("error compiling included template %s: %w", componentName, err)
-			return match
+// blameSource converts a positioned parser error into a *TemplateError for file.
+func (c *Compiler) blameSource(file string, err error) error {
+	var perr *blade.Error
+	if errors.As(err, &perr) {
+		return &TemplateError{
+			Template: file,
+			Location: SourceLocation{File: file, Line: perr.Pos.Line, Col: perr.Pos.Col},
+			Message:  perr.Msg,
+			Err:      err,
 		}
-		return componentContent
-	})
-	if includeErr != nil {
-		return "", includeErr
 	}
-	return content, nil
+	return err
 }
 
-// processIfStatements handles @if directives (translated from Blade to Go templates)
-func (c *Compiler) processIfStatements(content, templatePath string) (string, error) {
-	// Helper to normalize conditions: $var -> .var
-	sanitize := func(cond string) string {
-		reVar := regexp.MustCompile(`\$(\w+)`)
-		return reVar.ReplaceAllString(cond, ".${1}")
+// processAllDirectives parses the Blade source into a document AST and
+// generates the equivalent html/template source in a single pass.
+func (c *Compiler) processAllDirectives(content, templatePath string) (string, error) {
+	compiled, err := c.processAllDirectivesMapped(content, templatePath)
+	if err != nil {
+		return "", err
 	}
-
-	// 1) Handle @if ... @else ... @endif blocks (multiline) first
-	ifElseRe := regexp.MustCompile(`(?s)@if\s*\((.*?)\)\s*(.*?)\s*@else\s*(.*?)\s*@endif`)
-	content = ifElseRe.ReplaceAllStringFunc(content, func(m string) string {
-		sub := ifElseRe.FindStringSubmatch(m)
-		if len(sub) < 4 {
-			return m
-		}
-		cond := sanitize(sub[1])
-		return "{{if " + cond + "}}" + sub[2] + "{{else}}" + sub[3] + "{{end}}"
-	})
-
-	// 2) Handle @if ... @endif blocks without else
-	ifRe := regexp.MustCompile(`(?s)@if\s*\((.*?)\)\s*(.*?)\s*@endif`)
-	content = ifRe.ReplaceAllStringFunc(content, func(m string) string {
-		sub := ifRe.FindStringSubmatch(m)
-		if len(sub) < 3 {
-			return m
-		}
-		cond := sanitize(sub[1])
-		return "{{if " + cond + "}}" + sub[2] + "{{end}}"
-	})
-
-	// 3) Handle @elseif (placed before @else to avoid conflicts)
-	elseifRe := regexp.MustCompile(`(?m)^\s*@elseif\s*\((.*?)\)\s*$`)
-	content = elseifRe.ReplaceAllStringFunc(content, func(m string) string {
-		sub := elseifRe.FindStringSubmatch(m)
-		if len(sub) < 2 {
-			return m
-		}
-		return "{{else if " + sanitize(sub[1]) + "}}"
-	})
-
-	// 4) Handle @else across multiple lines
-	elseRe := regexp.MustCompile(`(?m)^\s*@else\s*$`)
-	content = elseRe.ReplaceAllString(content, "{{else}}")
-
-	// 5) Handle any remaining single @if (open block)
-	openIfRe := regexp.MustCompile(`@if\s*\((.*?)\)`)
-	content = openIfRe.ReplaceAllStringFunc(content, func(m string) string {
-		sub := openIfRe.FindStringSubmatch(m)
-		if len(sub) < 2 {
-			return m
-		}
-		return "{{if " + sanitize(sub[1]) + "}}"
-	})
-
-	// 6) Replace any leftover @endif (start of line, may have indentation)
-	endIfRe := regexp.MustCompile(`(?m)^[ \t]*@endif[ \t]*$`)
-	content = endIfRe.ReplaceAllString(content, "{{end}}")
-
-	return content, nil
+	return compiled.Text, nil
 }
 
-func (c *Compiler) processElse(content, templatePath string) (string, error) {
-	// Handle @elseif across multiple lines and with possible indentation
-	elseifRe := regexp.MustCompile(`(?m)^\s*@elseif\s*\((.*?)\)`)
-	content = elseifRe.ReplaceAllString(content, "{{else if $1}}")
-
-	// Handle @else across multiple lines and with possible indentation
-	elseRe := regexp.MustCompile(`(?m)^\s*@else\s*`)
-	content = elseRe.ReplaceAllString(content, "{{else}}")
-
-	return content, nil
-}
-
-func (c *Compiler) processEndif(content, templatePath string) (string, error) {
-	content = strings.ReplaceAll(content, "@endif", "{{end}}")
-	return content, nil
-}
-
-// processForeach xử lý @foreach
-func (c *Compiler) processForeach(content, templatePath string) (string, error) {
-	normalize := func(coll, item string) (string, string) {
-		coll = strings.TrimSpace(coll)
-		item = strings.TrimSpace(item)
-		// Normalize collection: always use dot context
-		if strings.HasPrefix(coll, "$") {
-			coll = "." + strings.TrimPrefix(coll, "$")
-		} else if !strings.HasPrefix(coll, ".") {
-			coll = "." + coll
-		}
-		// Left side (item variable name) used to rewrite the body
-		if strings.HasPrefix(item, "$") {
-			// keep it for rewrite, but the range will not use this variable
-		} else {
-			item = "$" + item
-		}
-		return coll, item
-	}
-
-	// Handle @foreach ... @endforeach blocks across multiple lines, including indentation
-	reBlock := regexp.MustCompile(`(?s)@foreach\s*\((.*?)\s+as\s+(.*?)\)\s*(.*?)\n[ \t]*@endforeach`)
-	content = reBlock.ReplaceAllStringFunc(content, func(m string) string {
-		sub := reBlock.FindStringSubmatch(m)
-		if len(sub) < 4 {
-			return m
-		}
-		coll, item := normalize(sub[1], sub[2])
-		body := sub[3]
-		// Rewrite body to replace $item. with . (dot)
-		// If users want to use $item alone, they can use {{$item}} which will be escaped.
-		// If they want raw output, they can use {!!$item!!}.
-		// So we only need to handle the dot access case here.
-		itemName := strings.TrimPrefix(item, "$")
-		reVar := regexp.MustCompile(`{{\s*\$` + regexp.QuoteMeta(itemName) + `\.`)
-		body = reVar.ReplaceAllString(body, "{{ .")
-		reRaw := regexp.MustCompile(`{!!\s*\$` + regexp.QuoteMeta(itemName) + `\.`)
-		body = reRaw.ReplaceAllString(body, "{!! .")
-		// Use direct range over the collection to avoid ':='
-		return "{{range " + coll + "}}" + body + "{{end}}"
-	})
-
-	// Handle @foreach on single line (open block)
-	reOpen := regexp.MustCompile(`@foreach\s*\((.*?)\s+as\s+(.*?)\)`)
-	content = reOpen.ReplaceAllStringFunc(content, func(m string) string {
-		sub := reOpen.FindStringSubmatch(m)
-		if len(sub) < 3 {
-			return m
-		}
-		coll, _ := normalize(sub[1], sub[2])
-		return "{{range " + coll + "}}"
-	})
-
-	// Handle any leftover @endforeach (start of line, may have indentation)
-	reEnd := regexp.MustCompile(`(?m)^[ \t]*@endforeach[ \t]*$`)
-	content = reEnd.ReplaceAllString(content, "{{end}}")
-
-	return content, nil
-}
-
-func (c *Compiler) processEndForeach(content, templatePath string) (string, error) {
-	content = strings.ReplaceAll(content, "@endforeach", "{{end}}")
-	return content, nil
-}
-
-// processUnless processes @unless
-func (c *Compiler) processUnless(content, templatePath string) (string, error) {
-	// Handle @unless ... @endunless blocks across multiple lines
-	re := regexp.MustCompile(`(?s)@unless\s*\((.*?)\)\s*(.*?)\s*@endunless`)
-	content = re.ReplaceAllString(content, "{{if not $1}}$2{{end}}")
-
-	// Handle @unless on single line
-	re = regexp.MustCompile(`@unless\s*\((.*?)\)`)
-	content = re.ReplaceAllString(content, "{{if not $1}}")
-	content = strings.ReplaceAll(content, "@endunless", "{{end}}")
-	return content, nil
-}
-
-// processVariables processes {{ }}
-func (c *Compiler) processVariables(content string, templatePath string) (string, error) {
-	// match {{ ... }} blocks (non-greedy)
-	re := regexp.MustCompile(`{{\s*(.*?)\s*}}`)
-	var containsCall func(expr.Expr) bool
-	containsCall = func(e expr.Expr) bool {
-		switch v := e.(type) {
-		case *expr.CallExpr:
-			return true
-		case *expr.PipeExpr:
-			return containsCall(v.Left) || containsCall(v.Right)
-		case *expr.DotAccess:
-			return containsCall(v.Base)
-		case *expr.IndexAccess:
-			return containsCall(v.Base) || containsCall(v.Key)
-		default:
-			return false
-		}
-	}
-
-	replace := func(m string) string {
-		sub := re.FindStringSubmatch(m)
-		if len(sub) < 2 {
-			return m
-		}
-		raw := strings.TrimSpace(sub[1])
-
-		// Try parse expression with AST parser.
-		if p := expr.NewParser(raw); p != nil {
-			if ast, err := p.Parse(); err == nil {
-				// If AST contains a call (method/function), preserve original expression exactly.
-				if containsCall(ast) {
-					// return original unchanged block (preserve spacing inside)
-					return fmt.Sprintf("{{ %s }}", raw)
-				}
-				// Otherwise convert simple $var -> .var style using a conservative replacement.
-				// Use AST -> template serialization if available, otherwise fallback to simple replace.
-				// Try to stringify AST if package provides ToTemplate (best effort).
-				if s, ok := tryASTToTemplate(ast); ok {
-					return fmt.Sprintf("{{ %s }}", s)
-				}
-			}
-		}
-
-		// Fallback: simple $var -> .var replacement (conservative)
-		conv := regexp.MustCompile(`\$(\w+)`).ReplaceAllString(raw, `.${1}`)
-		return fmt.Sprintf("{{ %s }}", conv)
+func (c *Compiler) processAllDirectivesMapped(content, templatePath string) (*mappedText, error) {
+	doc, err := blade.Parse(content, c.currentSyntax())
+	if err != nil {
+		return nil, c.blameSource(c.sourceName(templatePath), err)
 	}
-
-	return re.ReplaceAllStringFunc(content, replace), nil
+	g := newCodegen(c, templatePath)
+	g.src = content
+	return g.generate(doc)
 }
 
-// tryASTToTemplate attempts to render an expr.Expr back to a Go template fragment.
-// If the expr package exposes a ToTemplate helper, use it; otherwise return ok=false
-func tryASTToTemplate(e expr.Expr) (string, bool) {
-	// best-effort: use interface method if implemented
-	type toTemplater interface {
-		ToTemplate() string
-	}
-	if tt, ok := e.(toTemplater); ok {
-		return tt.ToTemplate(), true
+// combineWithLayout combines content with layout
+func (c *Compiler) combineWithLayout(content, layoutName string) (string, error) {
+	combined, err := c.combineWithLayoutMapped(plainText(content), layoutName)
+	if err != nil {
+		return "", err
 	}
-	// no helper available, bail out
-	return "", false
+	return combined.Text, nil
 }
 
-// helper char checks
-// NOTE: previous tokenizer helpers removed after migrating to expr parser.
+var (
+	defineStartRe  = regexp.MustCompile(`{{\s*define\s*"([^"]+)"\s*}}`)
+	templateCallRe = regexp.MustCompile(`{{\s*template\s*"([^"]+)"\s*\.\s*}}`)
+	blockStartRe   = regexp.MustCompile(`{{-?\s*block\s*"([^"]+)"\s*\.\s*-?}}`)
+	hasSectionRe   = regexp.MustCompile(`hasSection "([^"]+)"`)
+)
 
-// processRawVariables processes {!! !!}
-func (c *Compiler) processRawVariables(content, templatePath string) (string, error) {
-	re := regexp.MustCompile(`{!!\s*(.*?)\s*!!}`)
-	content = re.ReplaceAllStringFunc(content, func(m string) string {
-		sub := re.FindStringSubmatch(m)
-		if len(sub) < 2 {
-			return m
-		}
-		expr := regexp.MustCompile(`\$(\w+)`).ReplaceAllString(sub[1], ".$1")
-		return "{{raw " + expr + "}}"
-	})
-	return content, nil
-}
+// parentMarker stands for @parent in a compiled section until the section is
+// merged with the same section of its parent layout.
+const parentMarker = "{{/*@parent*/}}"
 
-// processComments processes {{-- --}}
-func (c *Compiler) processComments(content, templatePath string) (string, error) {
-	re := regexp.MustCompile(`{{--(.*?)--}}`)
-	content = re.ReplaceAllString(content, "")
-	return content, nil
-}
+// maxLayoutDepth bounds @extends chains so cyclic layouts fail to compile.
+const maxLayoutDepth = 32
 
-// processPhp processes @php @endphp
-func (c *Compiler) processPhp(content, templatePath string) (string, error) {
-	re := regexp.MustCompile(`@php(.*?)@endphp`)
-	content = re.ReplaceAllString(content, "")
-	return content, nil
+// combineWithLayoutMapped is combineWithLayout operating on mapped text so
+// the result keeps pointing at the page and layout sources.
+func (c *Compiler) combineWithLayoutMapped(content *mappedText, layoutName string) (*mappedText, error) {
+	return c.combineChain(content, layoutName, 0)
 }
 
-// combineWithLayout combines content with layout
-func (c *Compiler) combineWithLayout(content, layoutName string) (string, error) {
+// combineChain merges the sections of content into layoutName. A layout that
+// itself @extends another contributes its sections, with the child's
+// sections taking precedence and @parent replaced by the layout's content,
+// and the merged sections continue up the chain to the base layout.
+func (c *Compiler) combineChain(content *mappedText, layoutName string, depth int) (*mappedText, error) {
+	if depth >= maxLayoutDepth {
+		return nil, fmt.Errorf("layout chain deeper than %d levels at %s, do the layouts extend each other?", maxLayoutDepth, layoutName)
+	}
 	layoutPath := filepath.Join(c.templatesDir, layoutName)
 
 	// Check if layout exists
 	if _, err := os.Stat(layoutPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("layout not found: %s", layoutName)
+		return nil, fmt.Errorf("layout not found: %s", layoutName)
 	}
 
 	layoutContent, err := os.ReadFile(layoutPath)
 	if err != nil {
-		return "", fmt.Errorf("error reading layout %s: %w", layoutName, err)
+		return nil, fmt.Errorf("error reading layout %s: %w", layoutName, err)
 	}
-
-	compiledLayout, err := c.CompileString(string(layoutContent), layoutPath)
+	_, parentLayout, err := c.processExtends(string(layoutContent))
+	if err != nil {
+		return nil, fmt.Errorf("error processing extends: %w", c.blameSource(c.sourceName(layoutPath), err))
+	}
+	compiledLayout, err := c.processAllDirectivesMapped(string(layoutContent), layoutPath)
 	if err != nil {
-		return "", fmt.Errorf("error compiling layout %s: %w", layoutName, err)
+		return nil, fmt.Errorf("error compiling layout %s: %w", layoutName, err)
 	}
 
 	// Extract define blocks from content: {{define "name"}}...{{end}}
-	// We must correctly match the corresponding {{end}} for the define, because the
-	// body can contain other {{end}} tokens (from if/range), so a naive regex may
-	// stop at the first {{end}}. We'll scan the content and balance block starts/ends.
-	defines := make(map[string]string)
-	contentNoDefines := content
-	startRe := regexp.MustCompile(`{{\s*define\s*"([^"]+)"\s*}}`)
-	for {
-		loc := startRe.FindStringSubmatchIndex(contentNoDefines)
-		if loc == nil {
-			break
-		}
-		// loc gives [start, end, groupStart, groupEnd]
-		defStart := loc[0]
-		defNameStart := loc[2]
-		defNameEnd := loc[3]
-		defBodyStart := loc[1]
-		name := contentNoDefines[defNameStart:defNameEnd]
-
-		// Now find the matching {{end}} for this define by scanning forward and
-		// balancing nested block starts (if, range, define) and ends.
-		i := defBodyStart
-		depth := 0
-		for i < len(contentNoDefines) {
-			// find next '{{'
-			next := strings.Index(contentNoDefines[i:], "{{")
-			if next == -1 {
-				// unmatched
-				break
-			}
-			i += next
-			// find the end '}}'
-			close := strings.Index(contentNoDefines[i:], "}}")
-			if close == -1 {
-				break
-			}
-			token := strings.TrimSpace(contentNoDefines[i+2 : i+close])
-			if strings.HasPrefix(token, "define") || strings.HasPrefix(token, "if") || strings.HasPrefix(token, "range") || strings.HasPrefix(token, "with") || strings.HasPrefix(token, "block") {
-				depth++
-			} else if token == "end" {
-				if depth == 0 {
-					// body runs from defBodyStart to i (start of this '{{end}}')
-					body := contentNoDefines[defBodyStart:i]
-					defines[name] = body
-					// remove the whole define block from contentNoDefines
-					// blockEnd is i + len("{{end}}")
-					blockEnd := i + close + 2
-					contentNoDefines = contentNoDefines[:defStart] + contentNoDefines[blockEnd:]
-					// continue scanning from start
-					break
-				}
-				depth--
-			}
-			// advance past this '}}'
-			i = i + close + 2
-		}
-		// loop again to find more defines
+	defines, contentNoDefines, err := extractDefines(content)
+	if err != nil {
+		return nil, err
 	}
 
-	// Helper to replace a specific template placeholder with the defined body if present
-	replaceTemplateWithBody := func(match string) string {
-		// match looks like {{template "name" .}}
-		r := regexp.MustCompile(`{{\s*template\s*"([^"]+)"\s*\.\s*}}`)
-		sub := r.FindStringSubmatch(match)
-		if len(sub) >= 2 {
-			nm := sub[1]
-			if body, ok := defines[nm]; ok {
-				return body
+	if parentLayout != "" {
+		// intermediate layout: merge its sections under the child's and move up
+		layoutDefines, _, err := extractDefines(compiledLayout)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling layout %s: %w", layoutName, err)
+		}
+		for name, body := range layoutDefines {
+			if child, ok := defines[name]; ok {
+				defines[name] = fillParent(child, body)
+			} else {
+				defines[name] = body
 			}
-			// if no define body, leave as-is (so runtime template lookup may succeed)
-			return match
 		}
-		return match
+		return c.combineChain(concatMapped(definesText(defines), contentNoDefines), parentLayout, depth+1)
 	}
 
-	// Replace content placeholder first
-	yieldRe := regexp.MustCompile(`{{\s*template\s*"content"\s*\.\s*}}`)
-	if yieldRe.MatchString(compiledLayout) {
-		compiledLayout = yieldRe.ReplaceAllStringFunc(compiledLayout, replaceTemplateWithBody)
-	}
-
-	// Replace any other {{template "name" .}} with defined body when available
-	anyYieldRe := regexp.MustCompile(`{{\s*template\s*"([^"]+)"\s*\.\s*}}`)
-	compiledLayout = anyYieldRe.ReplaceAllStringFunc(compiledLayout, func(m string) string {
-		sub := anyYieldRe.FindStringSubmatch(m)
-		if len(sub) >= 2 {
-			nm := sub[1]
-			if body, ok := defines[nm]; ok {
-				return body
-			}
+	// Replace any {{template "name" .}} with the defined body when available;
+	// otherwise leave it so runtime template lookup may succeed
+	compiledLayout = replaceAllMapped(templateCallRe, compiledLayout, func(sub []int) *mappedText {
+		if body, ok := defines[compiledLayout.Text[sub[2]:sub[3]]]; ok {
+			return body
 		}
-		return m
+		return compiledLayout.slice(sub[0], sub[1])
 	})
 
-	// If layout contains block placeholders (which provide default content),
-	// and the page provided a section (define) with the same name, replace the
-	// entire block (including its default content) with the page's section body.
-	// This implements Blade-style section overriding where layout blocks are
-	// replaced by page sections.
-	blockRe := regexp.MustCompile(`(?s){{\s*block\s*"([^"]+)"\s*\.\s*}}(.*?){{\s*end\s*}}`)
-	// Iteratively replace blocks to correctly handle nested blocks: replace until
-	// no block tokens remain or replacements stop changing the layout.
-	for blockRe.MatchString(compiledLayout) {
-		before := compiledLayout
-		compiledLayout = blockRe.ReplaceAllStringFunc(compiledLayout, func(m string) string {
-			sub := blockRe.FindStringSubmatch(m)
-			if len(sub) >= 3 {
-				nm := sub[1]
-				if body, ok := defines[nm]; ok {
-					// Use the page-provided body instead of layout default
-					return body
-				}
-				// otherwise keep the default content (sub[2])
-				return sub[2]
-			}
-			return m
-		})
-		if compiledLayout == before {
-			break
-		}
+	// If layout contains block placeholders (which provide default content,
+	// from {{block}}, @yield or @section...@show) and the page provided a
+	// section (define) with the same name, replace the entire block with the
+	// page's section body, where @parent stands for the default content.
+	// Blocks are scanned left to right and replaced bodies are scanned again,
+	// so nested blocks are handled.
+	compiledLayout, err = replaceBlocks(compiledLayout, defines)
+	if err != nil {
+		return nil, err
 	}
 
-	// If layout had no placeholders replaced, prefer content bodies by appending
-	if contentNoDefines != "" {
-		compiledLayout = compiledLayout + contentNoDefines
+	// Append content outside sections after the layout
+	if contentNoDefines.Text != "" {
+		compiledLayout = concatMapped(compiledLayout, contentNoDefines)
 	} else {
-		compiledLayout = compiledLayout + content
+		compiledLayout = concatMapped(compiledLayout, content)
 	}
 
 	// Prepend all define blocks as named templates so any {{template "name" .}} lookups
 	// resolve even if we didn't inline them. This prevents 'no such template' errors.
 	if len(defines) > 0 {
-		var defs strings.Builder
-		for nm, body := range defines {
+		names := make([]string, 0, len(defines))
+		for nm := range defines {
+			names = append(names, nm)
+		}
+		sort.Strings(names)
+		var defs mappedBuilder
+		for _, nm := range names {
 			// don't prepend if compiledLayout already contains a define or block for this name
 			// ({{block "name" ...}} also registers a template with that name and will
 			// cause a duplicate-definition error if we prepend another {{define}}).
-			if strings.Contains(compiledLayout, "{{define \""+nm+"\"}}") || strings.Contains(compiledLayout, "{{block \""+nm+"\"") {
+			if strings.Contains(compiledLayout.Text, "{{define \""+nm+"\"}}") || strings.Contains(compiledLayout.Text, "{{block \""+nm+"\"") {
 				continue
 			}
-			defs.WriteString("{{define \"")
-			defs.WriteString(nm)
-			defs.WriteString("\"}}")
-			defs.WriteString(body)
-			defs.WriteString("{{end}}")
+			defs.write("{{define \""+nm+"\"}}", SourceLocation{}, false)
+			defs.writeMapped(fillParent(defines[nm], nil))
+			defs.write("{{end}}", SourceLocation{}, false)
 		}
 		if defs.Len() > 0 {
-			compiledLayout = defs.String() + compiledLayout
+			compiledLayout = concatMapped(defs.mapped(), compiledLayout)
+		}
+	}
+
+	return resolveSectionChecks(compiledLayout, defines), nil
+}
+
+// extractDefines removes the top-level {{define "name"}}...{{end}} blocks
+// from content and returns their bodies by name.
+func extractDefines(content *mappedText) (map[string]*mappedText, *mappedText, error) {
+	// We must correctly match the corresponding {{end}} for the define, because the
+	// body can contain other {{end}} tokens (from if/range), so a naive regex may
+	// stop at the first {{end}}.
+	defines := make(map[string]*mappedText)
+	rest := content
+	for {
+		text := rest.Text
+		loc := defineStartRe.FindStringSubmatchIndex(text)
+		if loc == nil {
+			return defines, rest, nil
+		}
+		name := text[loc[2]:loc[3]]
+		endStart, endStop, ok := matchEnd(text, loc[1])
+		if !ok {
+			return nil, nil, fmt.Errorf("unterminated define %q", name)
+		}
+		defines[name] = rest.slice(loc[1], endStart)
+		rest = concatMapped(rest.slice(0, loc[0]), rest.slice(endStop, len(text)))
+	}
+}
+
+// matchEnd finds the {{end}} closing the action whose body starts at from,
+// balancing nested block starts (if, range, with, define, block) and ends.
+// It returns the offsets of the start and end of that {{end}} action.
+func matchEnd(text string, from int) (int, int, bool) {
+	depth := 0
+	i := from
+	for i < len(text) {
+		next := strings.Index(text[i:], "{{")
+		if next == -1 {
+			break
+		}
+		i += next
+		close := strings.Index(text[i:], "}}")
+		if close == -1 {
+			break
+		}
+		token := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text[i+2:i+close], "-"), "-"))
+		switch firstWord(token) {
+		case "define", "if", "range", "with", "block":
+			depth++
+		case "end":
+			if depth == 0 {
+				return i, i + close + 2, true
+			}
+			depth--
+		}
+		i += close + 2
+	}
+	return 0, 0, false
+}
+
+// replaceBlocks replaces each {{block "name" .}}default{{end}} with the
+// section of that name, or with its default content when there is none.
+func replaceBlocks(layout *mappedText, defines map[string]*mappedText) (*mappedText, error) {
+	from := 0
+	for n := 0; ; n++ {
+		if n > 10000 {
+			return nil, fmt.Errorf("sections expand recursively, does a section @yield itself?")
+		}
+		loc := blockStartRe.FindStringSubmatchIndex(layout.Text[from:])
+		if loc == nil {
+			return layout, nil
+		}
+		for i := range loc {
+			loc[i] += from
+		}
+		endStart, endStop, ok := matchEnd(layout.Text, loc[1])
+		if !ok {
+			return nil, fmt.Errorf("unterminated block %q", layout.Text[loc[2]:loc[3]])
 		}
+		def := layout.slice(loc[1], endStart)
+		repl := def
+		if body, ok := defines[layout.Text[loc[2]:loc[3]]]; ok {
+			repl = fillParent(body, def)
+		}
+		layout = concatMapped(layout.slice(0, loc[0]), repl, layout.slice(endStop, len(layout.Text)))
+		from = loc[0]
 	}
+}
 
-	return compiledLayout, nil
+// fillParent replaces the @parent markers in a section with the parent's
+// content for the same section, or removes them when parent is nil.
+func fillParent(section, parent *mappedText) *mappedText {
+	if !strings.Contains(section.Text, parentMarker) {
+		return section
+	}
+	if parent == nil {
+		parent = plainText("")
+	}
+	return replaceAllMapped(parentMarkerRe, section, func([]int) *mappedText { return parent })
 }
 
+var parentMarkerRe = regexp.MustCompile(regexp.QuoteMeta(parentMarker))
+
+// definesText renders sections as {{define}} blocks in name order.
+func definesText(defines map[string]*mappedText) *mappedText {
+	names := make([]string, 0, len(defines))
+	for nm := range defines {
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+	var b mappedBuilder
+	for _, nm := range names {
+		b.write("{{define \""+nm+"\"}}", SourceLocation{}, false)
+		b.writeMapped(defines[nm])
+		b.write("{{end}}", SourceLocation{}, false)
+	}
+	return b.mapped()
+}
+
+// resolveSectionChecks turns the hasSection "name" conditions emitted for
+// @hasSection and @sectionMissing into constants, now that the sections
+// provided by the page and its layouts are known.
+func resolveSectionChecks(m *mappedText, defines map[string]*mappedText) *mappedText {
+	if !strings.Contains(m.Text, "hasSection \"") {
+		return m
+	}
+	return replaceAllMapped(hasSectionRe, m, func(sub []int) *mappedText {
+		v := "false"
+		if body, ok := defines[m.Text[sub[2]:sub[3]]]; ok && strings.TrimSpace(body.Text) != "" {
+			v = "true"
+		}
+		loc, _ := m.locate(sub[0])
+		var b mappedBuilder
+		b.write(v, loc, false)
+		return b.mapped()
+	})
+}
+
+// validationName is the template name used when validating compiled text.
+const validationName = "validation"
+
 // validateTemplateSyntax validates the syntax of the compiled template
 func (c *Compiler) validateTemplateSyntax(content string) error {
 	// Create a test template to validate syntax
-	testTmpl := template.New("validation").Funcs(c.funcMap)
+	testTmpl := template.New(validationName).Funcs(c.funcs())
 	_, err := testTmpl.Parse(content)
 	if err != nil {
 		return fmt.Errorf("template syntax error: %w", err)
@@ -855,7 +853,7 @@ func (c *Compiler) ParseTemplate(templatePath string) (*template.Template, error
 	// In go mode with embedded FS, parse the full template set using ParseFS so cross-file templates are available
 	if c.mode == "go" && c.fs != nil {
 		rootName := filepath.Base(templatePath)
-		tmpl := template.New(rootName).Funcs(c.funcMap)
+		tmpl := template.New(rootName).Funcs(c.funcs()).Option(c.missingKey())
 		// parse common folders, support both .html and .gohtml
 		if _, err := tmpl.ParseFS(c.fs, "components/*.*html", "layouts/*.*html", "pages/*.*html"); err == nil {
 			return tmpl, nil
@@ -868,13 +866,16 @@ func (c *Compiler) ParseTemplate(templatePath string) (*template.Template, error
 		// continue to fallback below
 	}
 
-	compiledContent, err := c.Compile(templatePath)
+	compiled, err := c.compileFile(templatePath)
 	if err != nil {
 		return nil, err
 	}
 
-	tmpl := template.New(filepath.Base(templatePath)).Funcs(c.funcMap)
-	return tmpl.Parse(compiledContent)
+	tmpl, err := template.New(filepath.Base(templatePath)).Funcs(c.funcs()).Option(c.missingKey()).Parse(compiled.Text)
+	if err != nil {
+		return nil, mapTemplateError(compiled, filepath.Base(templatePath), c.sourceName(templatePath), err)
+	}
+	return tmpl, nil
 }
 
 // DebugCompile prints the compilation steps for a given template
@@ -897,8 +898,8 @@ func (c *Compiler) DebugCompile(templatePath string) error {
 	fmt.Printf("Layout: %s\n", layout)
 	fmt.Println(content1)
 
-	fmt.Println("\n=== AFTER PROCESSING SECTIONS ===")
-	content2, err := c.processSections(content1, templatePath)
+	fmt.Println("\n=== AFTER PROCESSING DIRECTIVES ===")
+	content2, err := c.processAllDirectives(content1, templatePath)
 	if err != nil {
 		return err
 	}
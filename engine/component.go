@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ComponentAttributes is the $attributes bag of a Blade component: every
+// attribute passed to the tag that is not declared with @props. Echoing it
+// renders the attributes as HTML, e.g. <div {{ $attributes }}>.
+type ComponentAttributes struct {
+	values map[string]interface{}
+}
+
+// NewComponentAttributes creates an attribute bag from name/value pairs.
+func NewComponentAttributes(values map[string]interface{}) *ComponentAttributes {
+	a := &ComponentAttributes{values: map[string]interface{}{}}
+	for k, v := range values {
+		a.values[k] = v
+	}
+	return a
+}
+
+// Get returns the value of an attribute, or nil.
+func (a *ComponentAttributes) Get(name string) interface{} {
+	return a.values[name]
+}
+
+// Has reports whether the attribute was passed.
+func (a *ComponentAttributes) Has(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+// Merge returns a new bag with defaults applied: passed attributes win,
+// except class, where the default classes are prepended. Defaults are given
+// as a map or as name/value pairs: $attributes->merge(['class' => 'alert'])
+// or $attributes.Merge "class" "alert".
+func (a *ComponentAttributes) Merge(defaults ...interface{}) (*ComponentAttributes, error) {
+	d, err := pairsToMap(defaults)
+	if err != nil {
+		return nil, fmt.Errorf("$attributes.Merge: %w", err)
+	}
+	out := NewComponentAttributes(d)
+	for k, v := range a.values {
+		if k == "class" {
+			if def := stringify(out.values[k]); def != "" {
+				v = strings.TrimSpace(def + " " + stringify(v))
+			}
+		}
+		out.values[k] = v
+	}
+	return out, nil
+}
+
+// String renders the bag as escaped HTML attributes in name order. true
+// renders a bare attribute; false and nil are omitted.
+func (a *ComponentAttributes) String() string {
+	names := make([]string, 0, len(a.values))
+	for k := range a.values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, k := range names {
+		switch v := a.values[k].(type) {
+		case nil:
+		case bool:
+			if v {
+				parts = append(parts, template.HTMLEscapeString(k))
+			}
+		default:
+			parts = append(parts, template.HTMLEscapeString(k)+`="`+template.HTMLEscapeString(stringify(v))+`"`)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// HTMLAttr lets html/template place the bag inside a tag.
+func (a *ComponentAttributes) HTMLAttr() template.HTMLAttr {
+	return template.HTMLAttr(a.String())
+}
+
+// component builds the data of one <x-name> usage. props holds the names
+// declared with @props and their defaults; attrs are the tag attributes;
+// slots records which slots were filled. Attributes matching a prop (also
+// kebab-case for camelCase props) set it, the rest go to $attributes.
+func component(props, attrs, slots map[string]interface{}) map[string]interface{} {
+	data := map[string]interface{}{}
+	for k, v := range props {
+		data[k] = v
+	}
+	bag := map[string]interface{}{}
+	for k, v := range attrs {
+		if hasKey(props, k) {
+			data[k] = v
+		} else if camel := camelCase(k); hasKey(props, camel) {
+			data[camel] = v
+		} else {
+			bag[k] = v
+		}
+	}
+	for k, v := range slots {
+		data[k] = v
+	}
+	data["attributes"] = NewComponentAttributes(bag)
+	if _, ok := data["slot"]; !ok {
+		data["slot"] = ""
+	}
+	return data
+}
+
+func hasKey(m map[string]interface{}, k string) bool {
+	_, ok := m[k]
+	return ok
+}
+
+// camelCase converts a kebab-case attribute name to camelCase.
+func camelCase(s string) string {
+	parts := strings.Split(s, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// dict builds a map from name/value pairs; it backs ['a' => 1] literals.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	return pairsToMap(pairs)
+}
+
+// list returns its arguments as a slice; it backs ['a', 'b'] literals.
+func list(items ...interface{}) []interface{} {
+	if items == nil {
+		return []interface{}{}
+	}
+	return items
+}
+
+// pairsToMap accepts a single map or alternating string keys and values.
+func pairsToMap(args []interface{}) (map[string]interface{}, error) {
+	if len(args) == 1 {
+		if m, ok := args[0].(map[string]interface{}); ok {
+			return m, nil
+		}
+	}
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("expected name/value pairs, got %d arguments", len(args))
+	}
+	m := make(map[string]interface{}, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		k, ok := args[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("key %v is %T, not a string", args[i], args[i])
+		}
+		m[k] = args[i+1]
+	}
+	return m, nil
+}
+
+// includeData builds the data of an included view: the parent's data (a
+// map, or the exported fields of a struct) overlaid with the parameters
+// passed to @include. The parent map itself is never modified.
+func includeData(parent interface{}, params map[string]interface{}) map[string]interface{} {
+	data := map[string]interface{}{}
+	v := reflect.ValueOf(parent)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			iter := v.MapRange()
+			for iter.Next() {
+				data[iter.Key().String()] = iter.Value().Interface()
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() {
+				data[f.Name] = v.Field(i).Interface()
+			}
+		}
+	}
+	for k, val := range params {
+		data[k] = val
+	}
+	return data
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComponentPropsDefaultsAndAttributes(t *testing.T) {
+	files := map[string]string{
+		"components/alert.blade.tpl": `@props(['type' => 'info', 'message'])
+<div {{ $attributes.Merge "class" (printf "alert alert-%s" $type) }}>{{ $message }}</div>`,
+		"pages/home.blade.tpl": `<x-alert :message="$msg" class="mt-4" id="a1" />
+<x-alert type="error" message="Boom" />`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"msg": "Saved <ok>"})
+	for _, want := range []string{
+		`<div class="alert alert-info mt-4" id="a1">Saved &lt;ok&gt;</div>`,
+		`<div class="alert alert-error">Boom</div>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestComponentAttributesMergeBladeSpelling(t *testing.T) {
+	files := map[string]string{
+		"components/button.blade.tpl": `<button {{ $attributes->merge(['class' => 'btn', 'type' => 'button']) }}>{{ $slot }}</button>`,
+		"pages/home.blade.tpl":        `<x-button class="btn-lg" type="submit">Go</x-button>`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", nil)
+	if want := `<button class="btn btn-lg" type="submit">Go</button>`; !strings.Contains(out, want) {
+		t.Fatalf("expected %q in output:\n%s", want, out)
+	}
+}
+
+func TestComponentDefaultAndNamedSlots(t *testing.T) {
+	files := map[string]string{
+		"components/card.blade.tpl": `<section><h2>{{ $title }}</h2>{{ $slot }}@if($footer)<footer>{{ $footer }}</footer>@endif</section>`,
+		"pages/home.blade.tpl": `@foreach($users as $user)<x-card>
+<x-slot:title>{{ $user.Name }} ({{ $site }})</x-slot>
+<p>{{ $loop.iteration }}</p>
+</x-card>@endforeach`,
+	}
+	data := map[string]interface{}{
+		"site": "S",
+		"users": []map[string]interface{}{
+			{"Name": "Ann", "Admin": false},
+		},
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", data)
+	if !strings.Contains(out, "<h2>Ann (S)</h2>") || !strings.Contains(out, "<p>1</p>") {
+		t.Fatalf("slots not rendered in caller scope:\n%s", out)
+	}
+	if strings.Contains(out, "<footer>") {
+		t.Fatalf("footer slot was not passed:\n%s", out)
+	}
+}
+
+func TestComponentScopeIsIsolated(t *testing.T) {
+	files := map[string]string{
+		"components/badge.blade.tpl": `@props(['label'])<b>[{{ $secret }}]{{ $label }}</b>`,
+		"pages/home.blade.tpl":       `<x-badge label="new" />`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"secret": "leak"})
+	if !strings.Contains(out, "<b>[]new</b>") {
+		t.Fatalf("component should not see page data:\n%s", out)
+	}
+}
+
+func TestNestedComponentsAndDottedNames(t *testing.T) {
+	files := map[string]string{
+		"components/forms/input.blade.tpl": `@props(['name'])<input name="{{ $name }}" {{ $attributes }}>`,
+		"components/panel.blade.tpl":       `<div class="panel">{{ $slot }}</div>`,
+		"pages/home.blade.tpl":             `<x-panel><x-forms.input name="email" required data-x="1" /></x-panel>`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", nil)
+	want := `<div class="panel"><input name="email" data-x="1" required></div>`
+	if !strings.Contains(out, want) {
+		t.Fatalf("expected %q in output:\n%s", want, out)
+	}
+}
+
+func TestMissingComponentReportsTag(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	_, err := c.CompileString(`<p>
+<x-nope />`, "pages/x.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), "component <x-nope> not found") || !strings.Contains(err.Error(), ":2:1") {
+		t.Fatalf("expected missing component error at 2:1, got %v", err)
+	}
+}
+
+func TestComponentNamedSlotFillsFlag(t *testing.T) {
+	files := map[string]string{
+		"components/card.blade.tpl": `<section>{{ $slot }}@if($footer)<footer>{{ $footer }}</footer>@endif</section>`,
+		"pages/home.blade.tpl":      `<x-card>body<x-slot name="footer">{{ $by }}</x-slot></x-card>`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"by": "Ann"})
+	if !strings.Contains(out, "<section>body<footer>Ann</footer></section>") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+// renderBlade compiles src with a blade compiler and executes it with data.
+func renderBlade(t *testing.T, src string, data interface{}) string {
+	t.Helper()
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	compiled, err := c.CompileString(src, "inline.blade.tpl")
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	tmpl, err := template.New("inline").Funcs(c.funcMap).Parse(compiled)
+	if err != nil {
+		t.Fatalf("parse error: %v\ncompiled: %s", err, compiled)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("execute error: %v\ncompiled: %s", err, compiled)
+	}
+	return buf.String()
+}
+
+// newEngine writes files to a temporary templates directory and returns an
+// engine over it with the other options of cfg.
+func newEngine(t *testing.T, files map[string]string, cfg BladeConfig) *BladeEngine {
+	t.Helper()
+	cfg.TemplatesDir = t.TempDir()
+	for name, content := range files {
+		writeTempTemplate(t, cfg.TemplatesDir, name, content)
+	}
+	return NewBladeEngineWithConfig(cfg)
+}
+
+// cachedConfig is the configuration of a production engine with a small
+// compiled template cache.
+var cachedConfig = BladeConfig{CacheEnabled: true, CacheMaxSizeMB: 1, CacheTTLMinutes: 1}
+
+// renderPage renders page from the given templates in development mode.
+func renderPage(t *testing.T, files map[string]string, page string, data interface{}) string {
+	t.Helper()
+	out, err := newEngine(t, files, BladeConfig{Development: true}).RenderString(page, data)
+	if err != nil {
+		t.Fatalf("render %s: %v", page, err)
+	}
+	return out
+}
+
+func TestInlineElseIfChainInAttribute(t *testing.T) {
+	src := `<p class="@if($a) x @elseif($b) y @else z @endif">`
+	cases := []struct {
+		a, b bool
+		want string
+	}{
+		{true, false, `<p class=" x ">`},
+		{false, true, `<p class=" y ">`},
+		{false, false, `<p class=" z ">`},
+	}
+	for _, tc := range cases {
+		got := renderBlade(t, src, map[string]interface{}{"a": tc.a, "b": tc.b})
+		if got != tc.want {
+			t.Fatalf("a=%v b=%v: got %q, want %q", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestMultiBranchElseIfInsideForeach(t *testing.T) {
+	src := `@foreach($items as $item)
+@if($item.Level)high
+@elseif($item.Mid)mid
+@elseif($item.Low)low
+@else none
+@endif
+@endforeach`
+	items := []map[string]interface{}{
+		{"Level": true},
+		{"Mid": true},
+		{"Low": true},
+		{},
+	}
+	got := renderBlade(t, src, map[string]interface{}{"items": items})
+	if strings.Join(strings.Fields(got), ",") != "high,mid,low,none" {
+		t.Fatalf("unexpected branch selection: %q", got)
+	}
+}
+
+func TestNestedIfInsideElseIf(t *testing.T) {
+	src := `@if($a)<a>@elseif($b)@if($c)<bc>@else<b>@endif@else<none>@endif`
+	got := renderBlade(t, src, map[string]interface{}{"a": false, "b": true, "c": true})
+	if got != "<bc>" {
+		t.Fatalf("got %q, want %q", got, "<bc>")
+	}
+}
+
+func TestElseIfAfterElseIsRejected(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	_, err := c.CompileString(`@if($a) a @else b @elseif($c) c @endif`, "bad.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), "@elseif after @else") {
+		t.Fatalf("expected @elseif after @else error, got %v", err)
+	}
+}
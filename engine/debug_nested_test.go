@@ -19,7 +19,7 @@ func TestDebugNestedCompile(t *testing.T) {
 
 	pagePath := filepath.Join(pagesDir, "nested_home.blade.tpl")
 	pageContent := `@extends('layouts/nested.blade.tpl')
-@section('inner')Overridden Inner@endsection
+@section('inner')Overridden Inner @endsection
 @section('content')<p>Body</p>@endsection`
 	_ = os.WriteFile(pagePath, []byte(pageContent), 0644)
 
@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"blade_engine/engine/blade"
+)
+
+// directiveNameRe matches the names accepted for custom directives.
+var directiveNameRe = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// Directive registers a compile-time directive. fn receives the raw
+// argument text of @name(...) and returns template source, Blade or Go
+// template syntax, which is compiled in place of the directive:
+//
+//	c.Directive("money", func(args string) string {
+//		return `{{ printf "%.2f" ` + args + ` }}`
+//	})
+//
+// Directives must be registered before the templates using them are
+// compiled; registering one makes previously compiled cache files stale.
+func (c *Compiler) Directive(name string, fn func(args string) string) error {
+	if err := c.checkCustomName(name); err != nil {
+		return err
+	}
+	c.extMu.Lock()
+	defer c.extMu.Unlock()
+	syn := c.syntax.Clone()
+	syn.Directive(name)
+	c.syntax = syn
+	if c.directives == nil {
+		c.directives = map[string]func(string) string{}
+	}
+	c.directives[name] = fn
+	c.extendedAt = time.Now()
+	return nil
+}
+
+// If registers a custom conditional: @name(args) ... @elsename(args) ...
+// @else ... @endname, plus @unlessname(args) ... @endname. The arguments
+// are evaluated at render time and passed to fn.
+func (c *Compiler) If(name string, fn func(args ...interface{}) bool) error {
+	if err := c.checkCustomName(name); err != nil {
+		return err
+	}
+	c.extMu.Lock()
+	defer c.extMu.Unlock()
+	syn := c.syntax.Clone()
+	syn.Block(name, blade.BlockSpec{End: []string{"end" + name}, Middle: []string{"else" + name, "else"}})
+	syn.Block("unless"+name, blade.BlockSpec{End: []string{"end" + name}, Middle: []string{"else"}})
+	c.syntax = syn
+	if c.conditions == nil {
+		c.conditions = map[string]func(...interface{}) bool{}
+	}
+	c.conditions[name] = fn
+	c.extendedAt = time.Now()
+	return nil
+}
+
+// checkCustomName rejects invalid names and names of built-in directives.
+func (c *Compiler) checkCustomName(name string) error {
+	if !directiveNameRe.MatchString(name) {
+		return fmt.Errorf("invalid directive name %q", name)
+	}
+	c.extMu.RLock()
+	defer c.extMu.RUnlock()
+	_, custom := c.directives[name]
+	_, cond := c.conditions[name]
+	if c.syntax.Known(name) && !custom && !cond {
+		return fmt.Errorf("directive @%s is already defined", name)
+	}
+	return nil
+}
+
+// customDirective returns the function registered for @name, if any.
+func (c *Compiler) customDirective(name string) (func(string) string, bool) {
+	c.extMu.RLock()
+	defer c.extMu.RUnlock()
+	fn, ok := c.directives[name]
+	return fn, ok
+}
+
+// customCondition returns the name of the conditional opened by block, which
+// is either @name or @unlessname.
+func (c *Compiler) customCondition(block string) (name string, negate, ok bool) {
+	c.extMu.RLock()
+	defer c.extMu.RUnlock()
+	if _, ok := c.conditions[block]; ok {
+		return block, false, true
+	}
+	if n, found := strings.CutPrefix(block, "unless"); found {
+		if _, ok := c.conditions[n]; ok {
+			return n, true, true
+		}
+	}
+	return "", false, false
+}
+
+// customIf evaluates a registered conditional at render time.
+func (c *Compiler) customIf(name string, args ...interface{}) (bool, error) {
+	c.extMu.RLock()
+	fn, ok := c.conditions[name]
+	c.extMu.RUnlock()
+	if !ok {
+		return false, fmt.Errorf("@%s is not registered", name)
+	}
+	return fn(args...), nil
+}
+
+// currentSyntax returns the directive set used for parsing.
+func (c *Compiler) currentSyntax() *blade.Syntax {
+	c.extMu.RLock()
+	defer c.extMu.RUnlock()
+	return c.syntax
+}
+
+// customDirective expands a directive registered with Compiler.Directive:
+// the returned source is parsed and generated in the current scope, so
+// Blade $variables in it resolve like anywhere else. Errors in the
+// expansion are reported at the directive.
+func (g *codegen) customDirective(n *blade.DirectiveNode, fn func(string) string) error {
+	for _, name := range g.expanding {
+		if name == n.Name {
+			return g.errorf(n.Pos, "@%s expands to itself", n.Name)
+		}
+	}
+	doc, err := blade.Parse(fn(n.Args), g.c.currentSyntax())
+	if err != nil {
+		return g.errorf(n.Pos, "@%s: %v", n.Name, err)
+	}
+	g.expanding = append(g.expanding, n.Name)
+	body, err := g.capture(func() error { return g.nodes(doc.Nodes) })
+	g.expanding = g.expanding[:len(g.expanding)-1]
+	if err != nil {
+		if terr, ok := err.(*TemplateError); ok && terr.Location.File == g.file {
+			return g.errorf(n.Pos, "@%s: %s", n.Name, terr.Message)
+		}
+		return err
+	}
+	g.at(n.Pos)
+	g.emit(body.Text)
+	return nil
+}
+
+// customIf emits a conditional registered with Compiler.If.
+func (g *codegen) customIf(n *blade.BlockNode, name string, negate bool) error {
+	cond := func(args string) string {
+		s := "customIf " + strconv.Quote(name)
+		for _, a := range blade.SplitArgs(args) {
+			if a != "" {
+				s += " " + g.value(a)
+			}
+		}
+		return s
+	}
+	c := cond(n.Args)
+	if negate {
+		c = "not (" + c + ")"
+	}
+	return g.ifBlock(n, c, cond)
+}
+
+// lastExtended returns the time of the last Directive, If or AddFuncs call
+// or strict mode change.
+func (c *Compiler) lastExtended() time.Time {
+	c.extMu.RLock()
+	defer c.extMu.RUnlock()
+	return c.extendedAt
+}
+
+// copyExtensions carries the directives, conditionals and functions
+// registered on other over to c, used when the engine recreates its compiler.
+func (c *Compiler) copyExtensions(other *Compiler) {
+	if other == nil {
+		return
+	}
+	other.extMu.RLock()
+	defer other.extMu.RUnlock()
+	c.AddFuncs(other.userFuncs)
+	for name, fn := range other.directives {
+		_ = c.Directive(name, fn)
+	}
+	for name, fn := range other.conditions {
+		_ = c.If(name, fn)
+	}
+	c.SetAuthorizer(other.authorizer)
+	c.SetCSRF(other.csrfKey, other.csrfField)
+}
@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCustomDirectiveAndConditional(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "pages/shop.blade.tpl", `<p>@money($price)</p>
+@plan('pro')<a>pro</a>@elseplan('team')<a>team</a>@else<span>free</span>@endplan
+@unlessplan('pro')<i>not pro</i>@endplan`)
+
+	// the engine preloads and caches templates before the directives exist
+	be := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, CacheEnabled: true, CacheMaxSizeMB: 1, CacheTTLMinutes: 1})
+	be.Directive("money", func(args string) string {
+		return `{{ printf "$%.2f" ` + args + ` }}`
+	})
+	be.If("plan", func(args ...interface{}) bool {
+		return len(args) == 1 && args[0] == "team"
+	})
+
+	out, err := be.RenderString("pages/shop.blade.tpl", map[string]interface{}{"price": 12.5})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for _, want := range []string{"<p>$12.50</p>", "<a>team</a>", "<i>not pro</i>"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "free") || strings.Contains(out, "@money") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
+
+func TestCustomDirectiveErrors(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	if err := c.Directive("foreach", func(string) string { return "" }); err == nil {
+		t.Fatal("expected an error when overriding a built-in directive")
+	}
+	if err := c.Directive("bad-name", func(string) string { return "" }); err == nil {
+		t.Fatal("expected an error for an invalid name")
+	}
+	_ = c.Directive("loop", func(string) string { return "@loop" })
+	_, err := c.CompileString("<p>\n@loop</p>", "inline.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), "inline.blade.tpl:2:1") || !strings.Contains(err.Error(), "expands to itself") {
+		t.Fatalf("expected a recursion error at the directive, got %v", err)
+	}
+}
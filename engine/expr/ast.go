@@ -2,36 +2,129 @@ package expr
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
-// Minimal AST node types for expressions we care about
+// Minimal AST node types for expressions we care about. Every node embeds
+// the Pos where it starts; operators and pipes record their operator.
 type Expr interface{}
 
-type Ident struct{ Name string }
-type DollarIdent struct{ Name string }
-type StringLit struct{ Val string }
-type NumberLit struct{ Val string }
+type Ident struct {
+	Pos
+	Name string
+}
+type DollarIdent struct {
+	Pos
+	Name string
+}
+type StringLit struct {
+	Pos
+	Val string
+}
+type NumberLit struct {
+	Pos
+	Val string
+}
 
 type DotAccess struct {
+	Pos
 	Base  Expr
 	Field string
 }
 type IndexAccess struct {
+	Pos
 	Base Expr
 	Key  Expr
 }
 type CallExpr struct {
+	Pos
 	Fn   Expr
 	Args []Expr
 }
+
+// PipeExpr is one stage of a pipeline, Left | Right. Pipelines nest to
+// the left: $x | a | b is Pipe(Pipe($x, a), b). Right is an Ident or a
+// CallExpr carrying the stage's own arguments.
 type PipeExpr struct {
+	Pos
+	Left  Expr
+	Right Expr
+}
+
+// UnaryExpr is !x or -x.
+type UnaryExpr struct {
+	Pos
+	Op string
+	X  Expr
+}
+
+// BinaryExpr is an arithmetic, comparison, logical, ?? or concatenation
+// operator applied to two operands.
+type BinaryExpr struct {
+	Pos
+	Op    string
 	Left  Expr
 	Right Expr
 }
 
+// TernaryExpr is cond ? then : else.
+type TernaryExpr struct {
+	Pos
+	Cond Expr
+	Then Expr
+	Else Expr
+}
+
+// ListLit is a list literal: ['a', 'b'].
+type ListLit struct {
+	Pos
+	Elems []Expr
+}
+
+// MapLit is a map literal: ['a' => 1, 'b' => $x]. Keys and Values are
+// parallel, in source order.
+type MapLit struct {
+	Pos
+	Keys   []Expr
+	Values []Expr
+}
+
 // Current represents the '.' root context in templates
-type Current struct{}
+type Current struct {
+	Pos
+}
+
+// PositionOf returns the position recorded in node e.
+func PositionOf(e Expr) Pos {
+	if n, ok := e.(interface{ Position() Pos }); ok {
+		return n.Position()
+	}
+	return Pos{}
+}
+
+// binaryFuncs names the template function each binary operator lowers to.
+// and and or are template builtins; the others are registered by the
+// engine's helper library. Comparisons use helpers rather than the eq, lt,
+// ... builtins, which reject operands of different kinds such as float64
+// and int.
+var binaryFuncs = map[string]string{
+	"+": "add", "-": "sub", "*": "mul", "/": "div", "%": "mod",
+	"~": "concat", ".": "concat",
+	"==": "equal", "!=": "notEqual", "===": "identical", "!==": "notIdentical",
+	"<": "less", "<=": "lessEqual", ">": "greater", ">=": "greaterEqual",
+	"&&": "and", "||": "or",
+	"??": "nullCoalesce",
+}
+
+// builtins are the html/template builtin functions. In a pipeline they
+// keep the template convention of taking the piped value last.
+var builtins = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true,
+	"js": true, "len": true, "not": true, "or": true, "print": true,
+	"printf": true, "println": true, "urlquery": true,
+	"eq": true, "ge": true, "gt": true, "le": true, "lt": true, "ne": true,
+}
 
 // Helper to check for simple dollar-based variable like $name or $user.Name
 func IsSimpleDollarVariable(e Expr) bool {
@@ -55,21 +148,57 @@ func IsSimpleDollarVariable(e Expr) bool {
 
 // ToTemplate converts an AST Expr back into a Go template expression string.
 // It also converts DollarIdent into dot-based access (e.g. $x -> .x) when serializing.
+// Operators become function calls: $a + 1 is add .a 1 and $a > 0 && !$b is
+// and (greater .a 0) (not .b). $c ? 'y' : 'n' picks a branch with and and or:
+// index (or (and .c (list "y")) (list "n")) 0. Array literals call list and
+// dict: ['a' => $x] is dict "a" .x.
 func ToTemplate(e Expr) (string, error) {
+	return Lower(e, nil)
+}
+
+// Lower is ToTemplate with a resolver for $variables: resolve maps a name
+// to its template reference, e.g. "item" to "$item" inside a loop. A nil
+// resolve gives dot access. A bare $ is the template root in either case.
+func Lower(e Expr, resolve func(name string) string) (string, error) {
+	return lowerer{resolve: resolve}.lower(e)
+}
+
+// LowerWithRoot is Lower for functions that read the template's root data:
+// a call of a function named by root gets $ as its first argument, so
+// old('email') is old $ "email".
+func LowerWithRoot(e Expr, resolve func(name string) string, root func(name string) bool) (string, error) {
+	return lowerer{resolve: resolve, root: root}.lower(e)
+}
+
+// lowerer serializes expressions with a variable resolver.
+type lowerer struct {
+	resolve func(name string) string
+	root    func(name string) bool
+}
+
+func (l lowerer) lower(e Expr) (string, error) {
 	switch v := e.(type) {
 	case *DollarIdent:
+		if v.Name == "" {
+			return "$", nil
+		}
+		if l.resolve != nil {
+			return l.resolve(v.Name), nil
+		}
 		return "." + v.Name, nil
 	case *Current:
 		return ".", nil
 	case *Ident:
+		if v.Name == "null" {
+			return "nil", nil
+		}
 		return v.Name, nil
 	case *StringLit:
-		// re-quote
-		return `"` + v.Val + `"`, nil
+		return strconv.Quote(v.Val), nil
 	case *NumberLit:
 		return v.Val, nil
 	case *DotAccess:
-		baseS, err := ToTemplate(v.Base)
+		baseS, err := l.operand(v.Base)
 		if err != nil {
 			return "", err
 		}
@@ -79,40 +208,207 @@ func ToTemplate(e Expr) (string, error) {
 		}
 		return baseS + "." + v.Field, nil
 	case *IndexAccess:
-		baseS, err := ToTemplate(v.Base)
+		baseS, err := l.operand(v.Base)
 		if err != nil {
 			return "", err
 		}
-		keyS, err := ToTemplate(v.Key)
+		keyS, err := l.operand(v.Key)
 		if err != nil {
 			return "", err
 		}
 		return "(index " + baseS + " " + keyS + ")", nil
 	case *CallExpr:
-		fnS, err := ToTemplate(v.Fn)
+		fn := v.Fn
+		// templates only call exported Go methods, so $a->merge() is .a.Merge
+		if d, ok := fn.(*DotAccess); ok {
+			fn = &DotAccess{Pos: d.Pos, Base: d.Base, Field: exported(d.Field)}
+		}
+		fnS, err := l.lower(fn)
 		if err != nil {
 			return "", err
 		}
-		parts := []string{fnS}
-		for _, a := range v.Args {
-			as, err := ToTemplate(a)
-			if err != nil {
-				return "", err
+		return l.call(l.fn(v.Fn, fnS), v.Args...)
+	case *PipeExpr:
+		return l.pipe(v)
+	case *UnaryExpr:
+		switch v.Op {
+		case "!":
+			return l.call("not", v.X)
+		case "-":
+			return l.call("sub", &NumberLit{Val: "0"}, v.X)
+		}
+		return "", fmt.Errorf("unsupported unary operator %q", v.Op)
+	case *BinaryExpr:
+		fn, ok := binaryFuncs[v.Op]
+		if !ok {
+			return "", fmt.Errorf("unsupported operator %q", v.Op)
+		}
+		if v.Op == "??" {
+			return l.coalesce(v)
+		}
+		return l.call(fn, v.Left, v.Right)
+	case *TernaryExpr:
+		return l.ternary(v)
+	case *ListLit:
+		return l.call("list", v.Elems...)
+	case *MapLit:
+		var args []Expr
+		for i, k := range v.Keys {
+			// dict keys are strings, so [1 => 'a'] keys by "1"
+			if n, ok := k.(*NumberLit); ok {
+				k = &StringLit{Pos: n.Pos, Val: n.Val}
 			}
-			parts = append(parts, as)
+			args = append(args, k, v.Values[i])
 		}
-		return strings.Join(parts, " "), nil
-	case *PipeExpr:
-		leftS, err := ToTemplate(v.Left)
+		return l.call("dict", args...)
+	default:
+		return "", fmt.Errorf("unsupported expr type %T", e)
+	}
+}
+
+// pipe serializes a pipeline stage. Blade filters take the piped value
+// first, so $s | truncate:20 is truncate $s 20, while builtins and methods
+// stay template pipes: $s | printf "<%s>" is $s | printf "<%s>".
+func (l lowerer) pipe(v *PipeExpr) (string, error) {
+	fn, args := v.Right, []Expr(nil)
+	if c, ok := fn.(*CallExpr); ok {
+		fn, args = c.Fn, c.Args
+	}
+	if id, ok := fn.(*Ident); ok && !builtins[id.Name] {
+		return l.call(l.fn(id, id.Name), append([]Expr{v.Left}, args...)...)
+	}
+	leftS, err := l.lower(v.Left)
+	if err != nil {
+		return "", err
+	}
+	rightS, err := l.lower(v.Right)
+	if err != nil {
+		return "", err
+	}
+	return leftS + " | " + rightS, nil
+}
+
+// ternary serializes c ? a : b so that only the chosen branch is
+// evaluated, as $user ? $user->name : 'guest' must not read name of a nil
+// user. and and or stop at the first deciding argument, and the branches
+// are wrapped in one-element lists to stay true when their value is not:
+// index (or (and .c (list .a)) (list .b)) 0.
+func (l lowerer) ternary(v *TernaryExpr) (string, error) {
+	var ops [3]string
+	for i, e := range []Expr{v.Cond, v.Then, v.Else} {
+		s, err := l.operand(e)
 		if err != nil {
 			return "", err
 		}
-		rightS, err := ToTemplate(v.Right)
+		ops[i] = s
+	}
+	return fmt.Sprintf("index (or (and %s (list %s)) (list %s)) 0", ops[0], ops[1], ops[2]), nil
+}
+
+// coalesce serializes a ?? b. When a is a field or index chain, it is
+// read with dig so that a missing key gives nil instead of an error:
+// $user->name ?? 'x' is nullCoalesce (dig . "user" "name") "x".
+func (l lowerer) coalesce(v *BinaryExpr) (string, error) {
+	var keys []Expr
+	cur := v.Left
+	for {
+		switch e := cur.(type) {
+		case *DotAccess:
+			keys = append([]Expr{&StringLit{Pos: e.Pos, Val: e.Field}}, keys...)
+			cur = e.Base
+			continue
+		case *IndexAccess:
+			keys = append([]Expr{e.Key}, keys...)
+			cur = e.Base
+			continue
+		}
+		break
+	}
+	var base string
+	switch e := cur.(type) {
+	case *Current:
+		base = "."
+	case *DollarIdent:
+		ref, err := l.lower(e)
+		if err != nil {
+			return "", err
+		}
+		// ".name", "$.name" and "$__c1.name" read a key of the data
+		if i := strings.IndexByte(ref, '.'); i >= 0 && ref != "." {
+			keys = append([]Expr{&StringLit{Pos: e.Pos, Val: ref[i+1:]}}, keys...)
+			ref = ref[:i]
+			if ref == "" {
+				ref = "."
+			}
+		}
+		base = ref
+	}
+	if base == "" || len(keys) == 0 {
+		return l.call("nullCoalesce", v.Left, v.Right)
+	}
+	dig, err := l.call("dig "+base, keys...)
+	if err != nil {
+		return "", err
+	}
+	right, err := l.operand(v.Right)
+	if err != nil {
+		return "", err
+	}
+	return "nullCoalesce (" + dig + ") " + right, nil
+}
+
+// fn returns the command for calling fn, lowered as s: functions that read
+// the root data take $ first.
+func (l lowerer) fn(fn Expr, s string) string {
+	if id, ok := fn.(*Ident); ok && l.root != nil && l.root(id.Name) {
+		return s + " $"
+	}
+	return s
+}
+
+// exported returns a method name with its first letter upper-cased.
+func exported(name string) string {
+	if name != "" && name[0] >= 'a' && name[0] <= 'z' {
+		return string(name[0]-'a'+'A') + name[1:]
+	}
+	return name
+}
+
+// call serializes a command: fn followed by its arguments as operands.
+func (l lowerer) call(fn string, args ...Expr) (string, error) {
+	parts := []string{fn}
+	for _, a := range args {
+		as, err := l.operand(a)
 		if err != nil {
 			return "", err
 		}
-		return leftS + " | " + rightS, nil
+		parts = append(parts, as)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// operand serializes e for use as an argument, parenthesizing commands.
+func (l lowerer) operand(e Expr) (string, error) {
+	s, err := l.lower(e)
+	if err != nil {
+		return "", err
+	}
+	switch v := e.(type) {
+	case *CallExpr:
+		if len(v.Args) == 0 {
+			return s, nil
+		}
+	case *ListLit:
+		if len(v.Elems) == 0 {
+			return s, nil
+		}
+	case *MapLit:
+		if len(v.Keys) == 0 {
+			return s, nil
+		}
+	case *PipeExpr, *UnaryExpr, *BinaryExpr, *TernaryExpr:
 	default:
-		return "", fmt.Errorf("unsupported expr type %T", e)
+		return s, nil
 	}
+	return "(" + s + ")", nil
 }
@@ -0,0 +1,43 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError reports an expression the parser cannot read. Its message
+// quotes the offending line of Source with a caret under Pos:
+//
+//	unexpected '.' at 1:7, expected a field name
+//	  $user..Name
+//	        ^
+type SyntaxError struct {
+	Source string
+	Pos    Pos
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at %s\n%s", e.Msg, e.Pos, e.Snippet())
+}
+
+// Snippet returns the source line holding the error with a caret under
+// the offending column, both indented by two spaces.
+func (e *SyntaxError) Snippet() string {
+	lines := strings.Split(e.Source, "\n")
+	if e.Pos.Line < 1 || e.Pos.Line > len(lines) {
+		return ""
+	}
+	line := lines[e.Pos.Line-1]
+	runes := []rune(line)
+	// keep tabs so the caret lines up in terminals
+	var pad strings.Builder
+	for i := 0; i < e.Pos.Col-1; i++ {
+		if i < len(runes) && runes[i] == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	return "  " + line + "\n  " + pad.String() + "^"
+}
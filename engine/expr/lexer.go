@@ -1,7 +1,10 @@
 package expr
 
 import (
+	"fmt"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type TokenType int
@@ -22,20 +25,91 @@ const (
 	TokComma
 	TokOp
 	TokOther
+	TokArrow  // -> property access
+	TokConcat // PHP-style " . " concatenation, a dot with spaces on both sides
 )
 
+// tokenNames are the descriptions used by TokenType.String.
+var tokenNames = map[TokenType]string{
+	TokEOF:         "end of expression",
+	TokIdent:       "identifier",
+	TokDollarIdent: "variable",
+	TokDot:         "'.'",
+	TokDotSpaced:   "'.'",
+	TokLBracket:    "'['",
+	TokRBracket:    "']'",
+	TokString:      "string",
+	TokNumber:      "number",
+	TokLParen:      "'('",
+	TokRParen:      "')'",
+	TokPipe:        "'|'",
+	TokComma:       "','",
+	TokOp:          "operator",
+	TokOther:       "character",
+	TokArrow:       "'->'",
+	TokConcat:      "'.'",
+}
+
+func (t TokenType) String() string {
+	if s, ok := tokenNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
 type Token struct {
 	Typ TokenType
 	Val string
+	// Space reports whitespace before the token, which separates Go
+	// template style call arguments: f (x) versus f(x).
+	Space bool
+	Pos   Pos
 }
 
+// String describes the token for error messages, e.g. identifier "foo".
+func (t Token) String() string {
+	switch t.Typ {
+	case TokEOF:
+		return t.Typ.String()
+	case TokIdent, TokNumber, TokOp, TokOther:
+		return fmt.Sprintf("%s %q", t.Typ, t.Val)
+	case TokDollarIdent:
+		return "variable $" + t.Val
+	case TokString:
+		return fmt.Sprintf("string %q", t.Val)
+	}
+	return t.Typ.String()
+}
+
+// Pos is a position in the expression source. Offset counts bytes from
+// the start; Line and Col start at 1, Col counting characters.
+type Pos struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+// Position returns p; AST nodes embed Pos to record where they start.
+func (p Pos) Position() Pos {
+	return p
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// operators lists the operator spellings, longest first so "===" wins over "==".
+var operators = []string{"===", "!==", "==", "!=", "<=", ">=", "&&", "||", "??", "=>", "<", ">", "+", "-", "*", "/", "%", "!", "?", ":", "~", "="}
+
 type Lexer struct {
 	input []rune
 	pos   int
+	at    Pos // position of input[pos]
+	err   *SyntaxError
 }
 
 func NewLexer(s string) *Lexer {
-	return &Lexer{input: []rune(s), pos: 0}
+	return &Lexer{input: []rune(s), pos: 0, at: Pos{Line: 1, Col: 1}}
 }
 
 func (l *Lexer) next() rune {
@@ -44,9 +118,29 @@ func (l *Lexer) next() rune {
 	}
 	r := l.input[l.pos]
 	l.pos++
+	l.at.Offset += utf8.RuneLen(r)
+	if r == '\n' {
+		l.at.Line++
+		l.at.Col = 1
+	} else {
+		l.at.Col++
+	}
 	return r
 }
 
+// skip consumes n runes.
+func (l *Lexer) skip(n int) {
+	for i := 0; i < n; i++ {
+		l.next()
+	}
+}
+
+// Err returns the first error met while lexing, such as an unterminated
+// string, or nil.
+func (l *Lexer) Err() *SyntaxError {
+	return l.err
+}
+
 func (l *Lexer) peek() rune {
 	if l.pos >= len(l.input) {
 		return 0
@@ -54,111 +148,144 @@ func (l *Lexer) peek() rune {
 	return l.input[l.pos]
 }
 
+func (l *Lexer) peekAt(off int) rune {
+	if l.pos+off >= len(l.input) {
+		return 0
+	}
+	return l.input[l.pos+off]
+}
+
 func (l *Lexer) emitToken(typ TokenType, val string) Token {
 	return Token{Typ: typ, Val: val}
 }
 
 func (l *Lexer) NextToken() Token {
 	hadSpace := false
-	for {
-		ch := l.peek()
-		if ch == 0 {
-			return l.emitToken(TokEOF, "")
+	for unicode.IsSpace(l.peek()) {
+		hadSpace = true
+		l.next()
+	}
+	at := l.at
+	t := l.token(hadSpace)
+	t.Space = hadSpace
+	t.Pos = at
+	return t
+}
+
+func (l *Lexer) token(hadSpace bool) Token {
+	ch := l.peek()
+	if ch == 0 {
+		return l.emitToken(TokEOF, "")
+	}
+	switch ch {
+	case '|':
+		if l.peekAt(1) == '|' {
+			l.skip(2)
+			return l.emitToken(TokOp, "||")
 		}
-		// whitespace
-		if unicode.IsSpace(ch) {
-			hadSpace = true
-			l.next()
-			continue
+		l.next()
+		return l.emitToken(TokPipe, "|")
+	case '(':
+		l.next()
+		return l.emitToken(TokLParen, "(")
+	case ')':
+		l.next()
+		return l.emitToken(TokRParen, ")")
+	case '.':
+		// single dot token; if there was whitespace before the dot, emit TokDotSpaced
+		l.next()
+		if hadSpace && unicode.IsSpace(l.peek()) {
+			return l.emitToken(TokConcat, ".")
 		}
-		switch ch {
-		case '|':
-			l.next()
-			return l.emitToken(TokPipe, "|")
-		case '(':
-			l.next()
-			return l.emitToken(TokLParen, "(")
-		case ')':
-			l.next()
-			return l.emitToken(TokRParen, ")")
-		case '.':
-			// single dot token; if there was whitespace before the dot, emit TokDotSpaced
-			l.next()
-			if hadSpace {
-				return l.emitToken(TokDotSpaced, ".")
-			}
-			return l.emitToken(TokDot, ".")
-		case '[':
-			l.next()
-			return l.emitToken(TokLBracket, "[")
-		case ']':
-			l.next()
-			return l.emitToken(TokRBracket, "]")
-		case ',':
-			l.next()
-			return l.emitToken(TokComma, ",")
-		case '$':
-			l.next()
-			// dollar identifier
-			var buf []rune
-			for unicode.IsLetter(l.peek()) || unicode.IsDigit(l.peek()) || l.peek() == '_' {
-				buf = append(buf, l.next())
-			}
-			return l.emitToken(TokDollarIdent, string(buf))
-		case '"', '\'':
-			q := l.next()
-			var buf []rune
-			for {
-				r := l.next()
-				if r == 0 {
-					break
-				}
-				if r == '\\' {
-					// include escaped char
-					nxt := l.next()
-					buf = append(buf, r, nxt)
-					continue
-				}
-				if r == q {
-					break
-				}
-				buf = append(buf, r)
-			}
-			return l.emitToken(TokString, string(buf))
-		default:
-			if unicode.IsDigit(ch) {
-				var buf []rune
-				for unicode.IsDigit(l.peek()) || l.peek() == '.' {
-					buf = append(buf, l.next())
-				}
-				return l.emitToken(TokNumber, string(buf))
-			}
-			if unicode.IsLetter(ch) {
-				var buf []rune
-				for unicode.IsLetter(l.peek()) || unicode.IsDigit(l.peek()) || l.peek() == '_' || l.peek() == '.' {
-					buf = append(buf, l.next())
-				}
-				return l.emitToken(TokIdent, string(buf))
-			}
-			// operators
-			if stringsContainsAny(string(ch), "+-*/%&><=") {
-				l.next()
-				return l.emitToken(TokOp, string(ch))
-			}
-			// fallback
-			l.next()
-			return l.emitToken(TokOther, string(ch))
+		if hadSpace {
+			return l.emitToken(TokDotSpaced, ".")
+		}
+		return l.emitToken(TokDot, ".")
+	case '[':
+		l.next()
+		return l.emitToken(TokLBracket, "[")
+	case ']':
+		l.next()
+		return l.emitToken(TokRBracket, "]")
+	case ',':
+		l.next()
+		return l.emitToken(TokComma, ",")
+	case '$':
+		l.next()
+		// dollar identifier
+		var buf []rune
+		for unicode.IsLetter(l.peek()) || unicode.IsDigit(l.peek()) || l.peek() == '_' {
+			buf = append(buf, l.next())
 		}
+		return l.emitToken(TokDollarIdent, string(buf))
+	case '"', '\'', '`':
+		return l.emitToken(TokString, l.str(l.next()))
 	}
+	if unicode.IsDigit(ch) {
+		var buf []rune
+		for unicode.IsDigit(l.peek()) || (l.peek() == '.' && unicode.IsDigit(l.peekAt(1))) {
+			buf = append(buf, l.next())
+		}
+		return l.emitToken(TokNumber, string(buf))
+	}
+	if unicode.IsLetter(ch) || ch == '_' {
+		var buf []rune
+		for unicode.IsLetter(l.peek()) || unicode.IsDigit(l.peek()) || l.peek() == '_' || l.peek() == '.' {
+			buf = append(buf, l.next())
+		}
+		return l.emitToken(TokIdent, string(buf))
+	}
+	if ch == '-' && l.peekAt(1) == '>' {
+		l.skip(2)
+		return l.emitToken(TokArrow, "->")
+	}
+	rest := string(l.input[l.pos:min(l.pos+3, len(l.input))])
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			l.skip(len(op))
+			return l.emitToken(TokOp, op)
+		}
+	}
+	// fallback
+	l.next()
+	return l.emitToken(TokOther, string(ch))
 }
 
-func stringsContainsAny(s, chars string) bool {
-	for _, c := range s {
-		for _, t := range chars {
-			if c == t {
-				return true
+// str reads a string literal opened by quote and returns its value. Double
+// and single quoted strings accept backslash escapes; backquoted strings
+// are raw, as in Go.
+func (l *Lexer) str(quote rune) string {
+	start := l.at
+	start.Offset--
+	start.Col--
+	var buf []rune
+	for {
+		if l.pos >= len(l.input) {
+			if l.err == nil {
+				l.err = &SyntaxError{Source: string(l.input), Pos: start, Msg: "unterminated string"}
+			}
+			break
+		}
+		r := l.next()
+		if r == quote {
+			break
+		}
+		if r == '\\' && quote != '`' {
+			switch nxt := l.next(); nxt {
+			case 'n':
+				buf = append(buf, '\n')
+			case 't':
+				buf = append(buf, '\t')
+			case 'r':
+				buf = append(buf, '\r')
+			case '\\', '"', '\'':
+				buf = append(buf, nxt)
+			default:
+				buf = append(buf, r, nxt)
 			}
+			continue
 		}
+		buf = append(buf, r)
 	}
-	return false
+	return string(buf)
 }
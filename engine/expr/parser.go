@@ -4,18 +4,85 @@ import (
 	"fmt"
 )
 
+// Operator precedences, lowest first. The pipe binds looser than all of
+// them and is handled by parsePipe.
+const (
+	precLowest = iota
+	precTernary
+	precCoalesce
+	precOr
+	precAnd
+	precEquality
+	precCompare
+	precAdditive
+	precMultiplicative
+	precUnary
+)
+
+// infixPrec returns the precedence of t as a binary operator, or 0.
+func infixPrec(t Token) int {
+	if t.Typ == TokConcat {
+		return precAdditive
+	}
+	if t.Typ != TokOp {
+		return 0
+	}
+	switch t.Val {
+	case "?":
+		return precTernary
+	case "??":
+		return precCoalesce
+	case "||":
+		return precOr
+	case "&&":
+		return precAnd
+	case "==", "===", "!=", "!==":
+		return precEquality
+	case "<", "<=", ">", ">=":
+		return precCompare
+	case "+", "-", "~":
+		return precAdditive
+	case "*", "/", "%":
+		return precMultiplicative
+	}
+	return 0
+}
+
 type Parser struct {
-	lex *Lexer
-	cur Token
+	lex   *Lexer
+	cur   Token
+	src   string
+	known func(name string) bool
 }
 
 func NewParser(input string) *Parser {
 	l := NewLexer(input)
-	p := &Parser{lex: l}
+	p := &Parser{lex: l, src: input}
 	p.cur = p.lex.NextToken()
 	return p
 }
 
+// Funcs makes the parser reject pipeline filters that are neither template
+// builtins nor known, so a misspelt filter fails when the template is
+// compiled rather than when it is parsed by html/template.
+func (p *Parser) Funcs(known func(name string) bool) *Parser {
+	p.known = known
+	return p
+}
+
+// errorf returns a *SyntaxError at pos.
+func (p *Parser) errorf(pos Pos, format string, args ...interface{}) error {
+	return &SyntaxError{Source: p.src, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// unexpected reports the current token, with what was expected if given.
+func (p *Parser) unexpected(expected string) error {
+	if expected != "" {
+		return p.errorf(p.cur.Pos, "unexpected %s, expected %s", p.cur, expected)
+	}
+	return p.errorf(p.cur.Pos, "unexpected %s", p.cur)
+}
+
 func (p *Parser) next() Token {
 	t := p.cur
 	p.cur = p.lex.NextToken()
@@ -26,139 +93,349 @@ func (p *Parser) expect(typ TokenType) (Token, error) {
 	if p.cur.Typ == typ {
 		return p.next(), nil
 	}
-	return Token{}, fmt.Errorf("expected token %v, got %v", typ, p.cur)
+	return Token{}, p.unexpected(typ.String())
 }
 
+// Parse parses the whole input as one expression. Errors are
+// *SyntaxError values pointing into the input.
 func (p *Parser) Parse() (Expr, error) {
-	return p.parsePipe()
+	e, err := p.parsePipe()
+	if lexErr := p.lex.Err(); lexErr != nil {
+		return nil, lexErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.cur.Typ != TokEOF {
+		return nil, p.unexpected("an operator or the end of the expression")
+	}
+	return e, nil
 }
 
-// parsePipe: for now treat pipe as binary right-associative
+// parsePipe parses a pipeline, $x | f | g args, left-associative: each
+// stage receives the result of the stages before it.
 func (p *Parser) parsePipe() (Expr, error) {
-	left, err := p.parsePrimary()
+	left, err := p.parseExpr(precLowest)
 	if err != nil {
 		return nil, err
 	}
-	if p.cur.Typ == TokPipe {
-		p.next()
-		right, err := p.parsePrimary()
+	for p.cur.Typ == TokPipe {
+		pipe := p.next()
+		stage, err := p.parseStage()
 		if err != nil {
 			return nil, err
 		}
-		return &PipeExpr{Left: left, Right: right}, nil
+		left = &PipeExpr{Pos: pipe.Pos, Left: left, Right: stage}
 	}
 	return left, nil
 }
 
+// parseStage parses a pipeline stage: a function with optional arguments
+// in any of the call styles, truncate 20 or truncate(20), or the filter
+// shorthand truncate:20,'...'.
+func (p *Parser) parseStage() (Expr, error) {
+	if p.cur.Typ != TokIdent && p.cur.Typ != TokDot && p.cur.Typ != TokDotSpaced {
+		return nil, p.unexpected("a filter name")
+	}
+	stage, err := p.parseCall()
+	if err != nil {
+		return nil, err
+	}
+	fn := stageFunc(stage)
+	if fn == nil {
+		return nil, p.errorf(PositionOf(stage), "a pipeline stage must be a function or method")
+	}
+	if id, ok := fn.(*Ident); ok && p.known != nil && !builtins[id.Name] && !p.known(id.Name) {
+		return nil, p.errorf(id.Pos, "unknown filter %q", id.Name)
+	}
+	if p.cur.Typ != TokOp || p.cur.Val != ":" {
+		return stage, nil
+	}
+	colon := p.next()
+	if _, ok := stage.(*CallExpr); ok {
+		return nil, p.errorf(colon.Pos, "filter arguments given twice")
+	}
+	var args []Expr
+	for {
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.cur.Typ != TokComma {
+			break
+		}
+		p.next()
+	}
+	return &CallExpr{Pos: PositionOf(stage), Fn: fn, Args: args}, nil
+}
+
+// stageFunc returns the function called by a pipeline stage, or nil when
+// the stage is not a call.
+func stageFunc(stage Expr) Expr {
+	if c, ok := stage.(*CallExpr); ok {
+		stage = c.Fn
+	}
+	if callable(stage) {
+		return stage
+	}
+	return nil
+}
+
+// parseExpr parses operators binding tighter than prec (Pratt parsing).
+// Ternary and ?? are right-associative, the other operators left.
+func (p *Parser) parseExpr(prec int) (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		opPrec := infixPrec(p.cur)
+		if opPrec <= prec {
+			return left, nil
+		}
+		op := p.next()
+		switch op.Val {
+		case "?":
+			then, err := p.parseExpr(precLowest)
+			if err != nil {
+				return nil, err
+			}
+			if p.cur.Typ != TokOp || p.cur.Val != ":" {
+				return nil, p.unexpected("':' of the ternary opened at " + op.Pos.String())
+			}
+			p.next()
+			els, err := p.parseExpr(precTernary - 1)
+			if err != nil {
+				return nil, err
+			}
+			left = &TernaryExpr{Pos: op.Pos, Cond: left, Then: then, Else: els}
+		case "??":
+			right, err := p.parseExpr(precCoalesce - 1)
+			if err != nil {
+				return nil, err
+			}
+			left = &BinaryExpr{Pos: op.Pos, Op: op.Val, Left: left, Right: right}
+		default:
+			right, err := p.parseExpr(opPrec)
+			if err != nil {
+				return nil, err
+			}
+			left = &BinaryExpr{Pos: op.Pos, Op: op.Val, Left: left, Right: right}
+		}
+	}
+}
+
+// parseUnary parses ! and unary minus, then a call or primary.
+func (p *Parser) parseUnary() (Expr, error) {
+	if p.cur.Typ == TokOp && (p.cur.Val == "!" || p.cur.Val == "-") {
+		op := p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := x.(*NumberLit); ok && op.Val == "-" {
+			return &NumberLit{Pos: op.Pos, Val: "-" + n.Val}, nil
+		}
+		return &UnaryExpr{Pos: op.Pos, Op: op.Val, X: x}, nil
+	}
+	return p.parseCall()
+}
+
+// parseCall parses a primary followed by Go template style arguments, as
+// in printf "%s" .Name. Only function names and field or method chains
+// take arguments this way.
+func (p *Parser) parseCall() (Expr, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !callable(base) {
+		return base, nil
+	}
+	_, isFunc := base.(*Ident)
+	var args []Expr
+	for startsOperand(p.cur) || isFunc && p.cur.Typ == TokConcat {
+		if p.cur.Typ == TokConcat {
+			args = append(args, &Current{Pos: p.next().Pos})
+			continue
+		}
+		arg, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if args == nil {
+		return base, nil
+	}
+	return &CallExpr{Pos: PositionOf(base), Fn: base, Args: args}, nil
+}
+
+// callable reports whether e may be followed by space separated arguments.
+func callable(e Expr) bool {
+	switch v := e.(type) {
+	case *Ident:
+		return v.Name != "true" && v.Name != "false" && v.Name != "nil" && v.Name != "null"
+	case *DotAccess:
+		return true
+	}
+	return false
+}
+
+// startsOperand reports whether t can begin a call argument.
+func startsOperand(t Token) bool {
+	switch t.Typ {
+	case TokDollarIdent, TokIdent, TokString, TokNumber, TokLParen, TokLBracket, TokDotSpaced:
+		return true
+	}
+	return false
+}
+
+// parsePrimary parses an operand with its field, index and call suffixes.
 func (p *Parser) parsePrimary() (Expr, error) {
 	var base Expr
 	switch p.cur.Typ {
 	case TokDollarIdent:
 		t := p.next()
-		base = &DollarIdent{Name: t.Val}
+		base = &DollarIdent{Pos: t.Pos, Name: t.Val}
 	case TokIdent:
 		t := p.next()
-		base = &Ident{Name: t.Val}
-	case TokDot:
+		base = &Ident{Pos: t.Pos, Name: t.Val}
+	case TokDot, TokDotSpaced:
 		// current context '.' followed by optional ident chain
-		p.next()
-		base = &Current{}
+		t := p.next()
+		base = &Current{Pos: t.Pos}
 		// if next is ident, parse as field chain
-		if p.cur.Typ == TokIdent {
+		if p.cur.Typ == TokIdent && !p.cur.Space {
 			fld := p.next().Val
-			base = &DotAccess{Base: base, Field: fld}
-		}
-	case TokDotSpaced:
-		// treat as current context as well
-		p.next()
-		base = &Current{}
-		if p.cur.Typ == TokIdent {
-			fld := p.next().Val
-			base = &DotAccess{Base: base, Field: fld}
+			base = &DotAccess{Pos: t.Pos, Base: base, Field: fld}
 		}
 	case TokString:
 		t := p.next()
-		return &StringLit{Val: t.Val}, nil
+		base = &StringLit{Pos: t.Pos, Val: t.Val}
 	case TokNumber:
 		t := p.next()
-		return &NumberLit{Val: t.Val}, nil
+		return &NumberLit{Pos: t.Pos, Val: t.Val}, nil
 	case TokLParen:
-		p.next()
-		e, err := p.Parse()
+		open := p.next()
+		e, err := p.parsePipe()
 		if err != nil {
 			return nil, err
 		}
-		if _, err := p.expect(TokRParen); err != nil {
+		if p.cur.Typ != TokRParen {
+			return nil, p.unexpected("')' closing the '(' at " + open.Pos.String())
+		}
+		p.next()
+		base = e
+	case TokLBracket:
+		lit, err := p.parseArrayLit()
+		if err != nil {
 			return nil, err
 		}
-		return e, nil
+		base = lit
+	case TokEOF:
+		return nil, p.unexpected("an operand")
 	default:
-		return nil, fmt.Errorf("unexpected token %v", p.cur)
-	}
-
-	// follow dot/index chain
-	var err error
-	base, err = p.parseFieldIndexChain(base)
-	if err != nil {
-		return nil, err
+		return nil, p.unexpected("")
 	}
+	return p.parseFieldIndexChain(base)
+}
 
-	// Support space-separated call args after a base (e.g. index .Map "key")
-	switch p.cur.Typ {
-	case TokDollarIdent, TokIdent, TokString, TokNumber, TokLParen, TokDot, TokDotSpaced:
-		var args []Expr
-		for p.cur.Typ != TokPipe && p.cur.Typ != TokRParen && p.cur.Typ != TokEOF {
-			if p.cur.Typ == TokComma {
-				p.next()
-				continue
+func (p *Parser) parseFieldIndexChain(base Expr) (Expr, error) {
+	for {
+		switch {
+		case (p.cur.Typ == TokDot || p.cur.Typ == TokArrow) && !p.cur.Space:
+			p.next()
+			if p.cur.Typ != TokIdent || p.cur.Space {
+				return nil, p.unexpected("a field name")
+			}
+			fld := p.next().Val
+			base = &DotAccess{Pos: PositionOf(base), Base: base, Field: fld}
+		case p.cur.Typ == TokLBracket && !p.cur.Space:
+			open := p.next()
+			key, err := p.parseExpr(precLowest)
+			if err != nil {
+				return nil, err
+			}
+			if p.cur.Typ != TokRBracket {
+				return nil, p.unexpected("']' closing the '[' at " + open.Pos.String())
 			}
-			arg, err := p.Parse()
+			p.next()
+			base = &IndexAccess{Pos: PositionOf(base), Base: base, Key: key}
+		case p.cur.Typ == TokLParen && !p.cur.Space && callable(base):
+			// PHP style call: upper($name), $user->format('Y')
+			args, err := p.parseArgs()
 			if err != nil {
 				return nil, err
 			}
-			args = append(args, arg)
+			base = &CallExpr{Pos: PositionOf(base), Fn: base, Args: args}
+		default:
+			return base, nil
 		}
-		return &CallExpr{Fn: base, Args: args}, nil
-	default:
-		return base, nil
 	}
 }
 
-func (p *Parser) parseFieldIndexChain(base Expr) (Expr, error) {
-	for {
-		if p.cur.Typ == TokDot {
+// parseArgs parses a parenthesized, comma separated argument list.
+func (p *Parser) parseArgs() ([]Expr, error) {
+	open := p.next()
+	args := []Expr{}
+	for p.cur.Typ != TokRParen {
+		if len(args) > 0 && p.cur.Typ != TokComma {
+			return nil, p.unexpected("',' or ')' closing the arguments at " + open.Pos.String())
+		}
+		if len(args) > 0 {
 			p.next()
-			if p.cur.Typ != TokIdent {
-				return nil, fmt.Errorf("expected ident after dot, got %v", p.cur)
-			}
-			fld := p.next().Val
-			base = &DotAccess{Base: base, Field: fld}
-			continue
 		}
-		if p.cur.Typ == TokLBracket {
+		arg, err := p.parseExpr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next() // )
+	return args, nil
+}
+
+// parseArrayLit parses a PHP-style array literal: a list ['a', 'b'] or a
+// map ['a' => 1, 'b' => 2]. A trailing comma is allowed; list and keyed
+// entries cannot be mixed.
+func (p *Parser) parseArrayLit() (Expr, error) {
+	open := p.next()
+	var keys, vals []Expr
+	for p.cur.Typ != TokRBracket {
+		if len(vals) > 0 {
+			if p.cur.Typ != TokComma {
+				return nil, p.unexpected("',' or ']' closing the '[' at " + open.Pos.String())
+			}
 			p.next()
-			// accept string, number or ident or dollarident
-			var key Expr
-			switch p.cur.Typ {
-			case TokString:
-				key = &StringLit{Val: p.next().Val}
-			case TokNumber:
-				key = &NumberLit{Val: p.next().Val}
-			case TokDollarIdent:
-				key = &DollarIdent{Name: p.next().Val}
-			case TokIdent:
-				key = &Ident{Name: p.next().Val}
-			default:
-				return nil, fmt.Errorf("unexpected token in index: %v", p.cur)
+			if p.cur.Typ == TokRBracket {
+				break
 			}
-			if _, err := p.expect(TokRBracket); err != nil {
+		}
+		start := p.cur.Pos
+		v, err := p.parseExpr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+		if p.cur.Typ == TokOp && p.cur.Val == "=>" {
+			if len(vals) > len(keys) {
+				return nil, p.errorf(p.cur.Pos, "keyed entry in a list; use keys for every entry")
+			}
+			p.next()
+			key := v
+			if v, err = p.parseExpr(precLowest); err != nil {
 				return nil, err
 			}
-			base = &IndexAccess{Base: base, Key: key}
-			continue
+			keys = append(keys, key)
+		} else if len(keys) > 0 {
+			return nil, p.errorf(start, "array entry needs a key, as in 'name' => value")
 		}
-		// function call on base? e.g. mapKeys $m -> not supported here unless ident
-		break
+		vals = append(vals, v)
+	}
+	p.next() // ]
+	if len(keys) > 0 {
+		return &MapLit{Pos: open.Pos, Keys: keys, Values: vals}, nil
 	}
-	return base, nil
+	return &ListLit{Pos: open.Pos, Elems: vals}, nil
 }
@@ -0,0 +1,161 @@
+package expr
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+
+	"blade_engine/engine/helpers"
+)
+
+func lower(t *testing.T, src string) string {
+	t.Helper()
+	e, err := NewParser(src).Parse()
+	if err != nil {
+		t.Fatalf("parse %q: %v", src, err)
+	}
+	out, err := ToTemplate(e)
+	if err != nil {
+		t.Fatalf("lower %q: %v", src, err)
+	}
+	return out
+}
+
+func TestOperatorsLowerToTemplateCalls(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{`$a + 1`, `add .a 1`},
+		{`$a + $b * 2`, `add .a (mul .b 2)`},
+		{`($a + $b) * 2`, `mul (add .a .b) 2`},
+		{`$a - $b - $c`, `sub (sub .a .b) .c`},
+		{`$count > 0`, `greater .count 0`},
+		{`$a == 'x' || !$b`, `or (equal .a "x") (not .b)`},
+		{`$a && $b || $c`, `or (and .a .b) .c`},
+		{`$a >= -1`, `greaterEqual .a -1`},
+		{`-$a`, `sub 0 .a`},
+		{`$ok ? 'yes' : 'no'`, `index (or (and .ok (list "yes")) (list "no")) 0`},
+		{`$a ? 1 : $b ? 2 : 3`, `index (or (and .a (list 1)) (list (index (or (and .b (list 2)) (list 3)) 0))) 0`},
+		{`$name ?? 'guest'`, `nullCoalesce (dig . "name") "guest"`},
+		{`$user->name ?? $m[$k] ?? 'x'`, `nullCoalesce (dig . "user" "name") (nullCoalesce (dig . "m" .k) "x")`},
+		{`upper($a) ?? 'x'`, `nullCoalesce (upper .a) "x"`},
+		{`$first . ' ' . $last`, `concat (concat .first " ") .last`},
+		{`$a ~ $b`, `concat .a .b`},
+		{`len $items > 0`, `greater (len .items) 0`},
+		{`upper($user->name)`, `upper .user.name`},
+		{`$user->format('Y', 2)`, `.user.Format "Y" 2`},
+		{`$user->profile()->name`, `.user.Profile.name`},
+		{`count($items) % 2 === 0`, `identical (mod (count .items) 2) 0`},
+		{`$m["a" ~ $k]`, `(index .m (concat "a" .k))`},
+		{`printf "%s" . | html`, `printf "%s" . | html`},
+		{`$a === null`, `identical .a nil`},
+		{`['a', $b, 1,]`, `list "a" .b 1`},
+		{`[]`, `list`},
+		{`['x' => 1, 'y' => [$a, 2]]`, `dict "x" 1 "y" (list .a 2)`},
+		{`[1 => 'one']`, `dict "1" "one"`},
+		{`in_array($x, ['a', 'b'])`, `in_array .x (list "a" "b")`},
+		{`['a', 'b'][0]`, `(index (list "a" "b") 0)`},
+		{`$name | lower | truncate 20`, `truncate (lower .name) 20`},
+		{`$price | money:"USD"`, `money .price "USD"`},
+		{`$s | truncate:10,'…' | upper`, `upper (truncate .s 10 "…")`},
+		{`$s | limit(5) | printf "<%s>" | html`, `limit .s 5 | printf "<%s>" | html`},
+		{`$a + 1 | printf "%d"`, `add .a 1 | printf "%d"`},
+		{`$user | .Format "Y"`, `.user | .Format "Y"`},
+	}
+	for _, c := range cases {
+		if got := lower(t, c.in); got != c.want {
+			t.Errorf("%s\n got: %s\nwant: %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{`$a +`, `$a ? 1`, `($a`, `$a $b`, `f(1 2)`, `$a = 1`, `['a' 'b']`, `['a' => 1, 2]`, `[1, 'b' => 2]`, `['a' =>]`, `$a |`, `$a | 'x'`, `$a | f(1):2`} {
+		if _, err := NewParser(in).Parse(); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestLoweredExpressionsExecute(t *testing.T) {
+	data := map[string]interface{}{"a": 7, "b": 2, "price": 2.5, "name": "", "items": []int{1, 2, 3}}
+	cases := []struct{ in, want string }{
+		{`$a + $b * 3`, `13`},
+		{`$a / $b`, `3.5`},
+		{`$a % $b`, `1`},
+		{`$price * 2`, `5`},
+		{`$a > $b && count($items) == 3`, `true`},
+		{`$name ?? 'x'`, ``},
+		{`$missing ?? 'x'`, `x`},
+		{`$missing->deep[0] ?? 'x'`, `x`},
+		{`$a > 5 ? 'big' : 'small'`, `big`},
+		{`'n=' + $a`, `n=7`},
+	}
+	// list is registered by the engine; ternaries lower to it
+	list := template.FuncMap{"list": func(v ...interface{}) []interface{} { return v }}
+	for _, c := range cases {
+		src := "{{ " + lower(t, c.in) + " }}"
+		tmpl, err := template.New("x").Funcs(helpers.Funcs()).Funcs(list).Parse(src)
+		if err != nil {
+			t.Fatalf("%s: parse %s: %v", c.in, src, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			t.Fatalf("%s: execute %s: %v", c.in, src, err)
+		}
+		if buf.String() != c.want {
+			t.Errorf("%s = %q, want %q", c.in, buf.String(), c.want)
+		}
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	_, err := NewParser(`$user..Name`).Parse()
+	serr, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("expected a *SyntaxError, got %T: %v", err, err)
+	}
+	if serr.Pos.Line != 1 || serr.Pos.Col != 7 {
+		t.Errorf("position = %s, want 1:7", serr.Pos)
+	}
+	want := "unexpected '.', expected a field name at 1:7\n  $user..Name\n        ^"
+	if serr.Error() != want {
+		t.Errorf("error:\n%s\nwant:\n%s", serr.Error(), want)
+	}
+
+	_, err = NewParser(`upper('abc`).Parse()
+	if serr, ok := err.(*SyntaxError); !ok || serr.Msg != "unterminated string" || serr.Pos.Col != 7 {
+		t.Errorf("unterminated string: %v", err)
+	}
+	if TokDollarIdent.String() != "variable" || TokEOF.String() != "end of expression" {
+		t.Errorf("token names: %s, %s", TokDollarIdent, TokEOF)
+	}
+}
+
+func TestUnknownFilter(t *testing.T) {
+	known := func(name string) bool { return name == "upper" }
+	if _, err := NewParser(`$a | upper | printf "%s"`).Funcs(known).Parse(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := NewParser(`$price | upper | mony:"USD"`).Funcs(known).Parse()
+	serr, ok := err.(*SyntaxError)
+	if !ok || serr.Msg != `unknown filter "mony"` || serr.Pos.Col != 18 {
+		t.Fatalf("expected an unknown filter error at 1:18, got %v", err)
+	}
+}
+
+func TestLowerWithRoot(t *testing.T) {
+	root := func(name string) bool { return name == "old" }
+	for in, want := range map[string]string{
+		`old('email')`:             `old $ "email"`,
+		`old('name', $user->name)`: `old $ "name" .user.name`,
+		`'email' | old`:            `old $ "email"`,
+		`upper(old('x'))`:          `upper (old $ "x")`,
+	} {
+		e, err := NewParser(in).Parse()
+		if err != nil {
+			t.Fatalf("parse %q: %v", in, err)
+		}
+		if got, err := LowerWithRoot(e, nil, root); err != nil || got != want {
+			t.Errorf("%s\n got: %s (%v)\nwant: %s", in, got, err, want)
+		}
+	}
+}
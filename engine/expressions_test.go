@@ -1,8 +1,12 @@
 package engine
 
 import (
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
+
+	"blade_engine/engine/expr"
 )
 
 // Table-driven tests for expression handling in processVariables/processRawVariables
@@ -54,3 +58,107 @@ func TestExpressionBracketFuzz(t *testing.T) {
 		}
 	}
 }
+
+func TestExpressionsRenderThroughAST(t *testing.T) {
+	src := `{{ $m["title"] }}|{{ printf "$%s" $price }}|{{ '$name' }}|{{ $name | upper | printf "<%s>" }}|` +
+		`@if($count > 1 && $m["title"] != "")many @endif|@unless(!$ok)ok @endunless|` +
+		`@foreach($m["tags"] as $tag){{ $loop->index + 1 }}.{{ $tag }} @endforeach|{!! $m["html"] ?? '-' !!}`
+	out := renderBlade(t, src, map[string]interface{}{
+		"m":     map[string]interface{}{"title": "Hi", "tags": []string{"a", "b"}, "html": "<b>x</b>"},
+		"price": "9",
+		"name":  "ann",
+		"count": 2,
+		"ok":    true,
+	})
+	want := `Hi|$9|$name|&lt;ANN&gt;|many |ok |1.a 2.b |<b>x</b>`
+	if out != want {
+		t.Fatalf("got  %s\nwant %s", out, want)
+	}
+}
+
+func TestComparisonsAcrossNumericTypes(t *testing.T) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"price": 9.5, "n": 3, "free": 0}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	src := `@if($price > 0)paid @endif|@if($free <= 0)free @endif|@if($n == 3 && $n == "3" && $n !== 4)three @endif|` +
+		`{{ $count >= 2.5 ? 'many' : 'few' }}|{{ $count < $price ? 'lt' : 'ge' }}`
+	for _, count := range []interface{}{3, int64(3), 3.0} {
+		data["count"] = count
+		if out, want := renderBlade(t, src, data), "paid |free |three |many|lt"; out != want {
+			t.Errorf("count %T: got %s, want %s", count, out, want)
+		}
+	}
+}
+
+func TestTernaryOnlyEvaluatesTheChosenBranch(t *testing.T) {
+	src := `{{ $user ? $user->Name : 'Guest' }}|{{ $n ? 'some' : '' }}|{{ $n === 0 ? 'zero' : 'other' }}|{{ $n !== "0" ? 'typed' : 'juggled' }}`
+	out := renderBlade(t, src, map[string]interface{}{"user": nil, "n": 0})
+	if want := "Guest||zero|typed"; out != want {
+		t.Fatalf("got %s, want %s", out, want)
+	}
+	out = renderBlade(t, src, map[string]interface{}{"user": &struct{ Name string }{"Ann"}, "n": 2})
+	if want := "Ann|some|other|typed"; out != want {
+		t.Fatalf("got %s, want %s", out, want)
+	}
+}
+
+func TestInvalidExpressionIsACompileError(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	_, err := c.CompileString("<p>\n  {{ $user..Name }}</p>", "bad.blade.tpl")
+	if err == nil {
+		t.Fatal("expected an error for {{ $user..Name }}")
+	}
+	var serr *expr.SyntaxError
+	if !errors.As(err, &serr) || serr.Pos.Col != 7 {
+		t.Fatalf("expected a *expr.SyntaxError at column 7, got %v", err)
+	}
+	var terr *TemplateError
+	if !errors.As(err, &terr) || terr.Location.Line != 2 || terr.Location.Col != 12 {
+		t.Fatalf("expected the error at the second dot, 2:12, got %v", err)
+	}
+	for _, want := range []string{"bad.blade.tpl:2:12", "expected a field name", "$user..Name\n        ^"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	_, err = c.CompileString("x @if( $ok && ]) y @endif", "bad.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), "bad.blade.tpl:1:15: invalid expression: unexpected ']'") {
+		t.Errorf("expected the error at the ] in the @if arguments, 1:15, got %v", err)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	files := map[string]string{
+		"partials/tags.blade.tpl":     `@foreach($tags as $tag)[{{ $tag }}]@endforeach {{ $opts["sep"] }}`,
+		"components/select.blade.tpl": `@props(['options'])<select>@foreach($options as $value => $label)<option value="{{ $value }}">{{ $label }}</option>@endforeach</select>`,
+		"pages/home.blade.tpl": `@include('partials.tags', ['tags' => ['a', 'b'], 'opts' => ['sep' => '|']])
+{{ in_array($x, ['a', 'b']) ? 'in' : 'out' }} {{ count([]) }}
+<x-select :options="['s' => 'Small', 'l' => 'Large']" />`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"x": "b"})
+	for _, want := range []string{
+		`[a][b] |`,
+		`in 0`,
+		`<select><option value="l">Large</option><option value="s">Small</option></select>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestPipelineFilters(t *testing.T) {
+	src := `{{ $name | lower | truncate 5 }}|{{ $price | money:"EUR" }}|{{ $name | truncate:3,'!' | printf "<%s>" }}`
+	out := renderBlade(t, src, map[string]interface{}{"name": "Annabel", "price": 9.5})
+	if want := `annab...|€9.50|&lt;Ann!&gt;`; out != want {
+		t.Fatalf("got  %s\nwant %s", out, want)
+	}
+
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	_, err := c.CompileString(`{{ $price | monye:"USD" }}`, "bad.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), `unknown filter "monye"`) {
+		t.Fatalf("expected an unknown filter error, got %v", err)
+	}
+}
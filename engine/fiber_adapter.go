@@ -1,7 +1,11 @@
 package engine
 
 import (
+	"bufio"
+	"errors"
 	"io"
+	"log"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -9,6 +13,9 @@ import (
 // FiberViewsAdapter implements fiber.Views by delegating to BladeEngine
 type FiberViewsAdapter struct {
 	Engine *BladeEngine
+	// FragmentHeader names the request header RenderFragmentWithCtx reads
+	// the fragment name from; "HX-Target" when empty.
+	FragmentHeader string
 }
 
 // Render implements fiber.Views: Render(w io.Writer, name string, data interface{}, layout ...string) error
@@ -26,21 +33,36 @@ func (v *FiberViewsAdapter) Load() error {
 // WithFiberContext injects a SafeFiberCtx under the `_fiber` key and returns a
 // data value suitable for passing to template execution. It accepts any data
 // shape and returns a map[string]interface{} that includes original fields plus
-// the `_fiber` entry.
+// the `_fiber` entry. When AuthMiddleware ran for the request, its
+// AuthContext is added under `_auth` for the authorization directives, and
+// the FormState of Form under `_form` for @error and old().
 func WithFiberContext(c *fiber.Ctx, data interface{}) map[string]interface{} {
 	// Always return a map[string]interface{} with _fiber as a concrete *SafeFiberCtx
+	nm := withEntry(data, "_fiber", NewSafeFiberCtx(c))
+	if auth, ok := c.Locals(authLocalsKey).(*AuthContext); ok {
+		nm["_auth"] = auth
+	}
+	if form, ok := c.Locals(formLocalsKey).(*FormState); ok {
+		nm["_form"] = form
+	}
+	return nm
+}
+
+// withEntry returns a copy of data as a map with key set to value. Data
+// that is not a map[string]interface{} is kept under the `_data` key.
+func withEntry(data interface{}, key string, value interface{}) map[string]interface{} {
 	if data == nil {
-		return map[string]interface{}{"_fiber": NewSafeFiberCtx(c)}
+		return map[string]interface{}{key: value}
 	}
 	if m, ok := data.(map[string]interface{}); ok {
 		nm := make(map[string]interface{}, len(m)+1)
 		for k, v := range m {
 			nm[k] = v
 		}
-		nm["_fiber"] = NewSafeFiberCtx(c)
+		nm[key] = value
 		return nm
 	}
-	return map[string]interface{}{"_fiber": NewSafeFiberCtx(c), "_data": data}
+	return map[string]interface{}{key: value, "_data": data}
 }
 
 // RenderWithCtx is a convenience that injects a SafeFiberCtx and writes the
@@ -55,3 +77,51 @@ func (v *FiberViewsAdapter) RenderWithCtx(c *fiber.Ctx, name string, data interf
 	// or c.Type("html")
 	return v.Engine.Render(w, name, enriched)
 }
+
+// RenderFragmentWithCtx is RenderWithCtx for htmx requests: when the
+// FragmentHeader names a @fragment of the template, only that fragment is
+// rendered. Without the header, as on a first visit, and for boosted
+// requests (HX-Boosted: true) the whole page is. Any other target that is
+// not a fragment is an error wrapping ErrFragmentNotFound, rather than a
+// full document swapped into the target element.
+func (v *FiberViewsAdapter) RenderFragmentWithCtx(c *fiber.Ctx, name string, data interface{}) error {
+	header := v.FragmentHeader
+	if header == "" {
+		header = "HX-Target"
+	}
+	c.Vary(header)
+	fragment := strings.TrimPrefix(c.Get(header), "#")
+	if fragment == "" {
+		return v.RenderWithCtx(c, name, data)
+	}
+	enriched := WithFiberContext(c, data)
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	err := v.Engine.RenderFragment(c.Context().Response.BodyWriter(), name, fragment, enriched)
+	if errors.Is(err, ErrFragmentNotFound) && c.Get("HX-Boosted") == "true" {
+		return v.RenderWithCtx(c, name, data)
+	}
+	return err
+}
+
+// StreamWithCtx is RenderWithCtx for large pages: the response is streamed
+// with fasthttp's SetBodyStreamWriter and flushed at each @flush and after
+// the layout's </head>, see BladeEngine.RenderStream. The template is
+// loaded first, so compile errors are returned as usual; errors during
+// rendering are logged, as the response has started by then. Fiber reuses
+// the context once the handler returns, so templates see a copy of the
+// request values under `_fiber`.
+func (v *FiberViewsAdapter) StreamWithCtx(c *fiber.Ctx, name string, data interface{}) error {
+	tmpl, err := v.Engine.load(name)
+	if err != nil {
+		return err
+	}
+	enriched := WithFiberContext(c, data)
+	enriched["_fiber"] = snapshotFiberCtx(c)
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := v.Engine.execute(tmpl, &flushWriter{w: w, flush: w.Flush}, name, "", enriched); err != nil {
+			log.Printf("blade: streaming %s: %v", name, err)
+		}
+	})
+	return nil
+}
@@ -1,6 +1,11 @@
 package engine
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
 
 // FiberAccessor defines the minimal methods templates are allowed to call.
 type FiberAccessor interface {
@@ -47,3 +52,51 @@ func (s *SafeFiberCtx) Query(key string) string {
 	}
 	return s.C.Query(key)
 }
+
+// fiberSnapshot is a FiberAccessor over copies of the request values, for
+// templates rendered after the handler has returned and Fiber has reused
+// its context, as when streaming.
+type fiberSnapshot struct {
+	headers map[string]string
+	params  map[string]string
+	query   map[string]string
+	locals  map[string]interface{}
+}
+
+// snapshotFiberCtx copies the headers, route parameters, query values and
+// string-keyed locals of c. Fiber's strings point into buffers that are
+// reused, so they are cloned.
+func snapshotFiberCtx(c *fiber.Ctx) *fiberSnapshot {
+	s := &fiberSnapshot{headers: map[string]string{}, params: map[string]string{}, query: map[string]string{}, locals: map[string]interface{}{}}
+	for k, vs := range c.GetReqHeaders() {
+		if len(vs) > 0 {
+			s.headers[http.CanonicalHeaderKey(k)] = strings.Clone(vs[0])
+		}
+	}
+	for k, v := range c.AllParams() {
+		s.params[strings.Clone(k)] = strings.Clone(v)
+	}
+	for k, v := range c.Queries() {
+		s.query[strings.Clone(k)] = strings.Clone(v)
+	}
+	c.Context().VisitUserValues(func(k []byte, v interface{}) {
+		s.locals[string(k)] = v
+	})
+	return s
+}
+
+func (s *fiberSnapshot) Header(k string) string {
+	return s.headers[http.CanonicalHeaderKey(k)]
+}
+
+func (s *fiberSnapshot) Param(name string) string {
+	return s.params[name]
+}
+
+func (s *fiberSnapshot) Local(key string) interface{} {
+	return s.locals[key]
+}
+
+func (s *fiberSnapshot) Query(key string) string {
+	return s.query[key]
+}
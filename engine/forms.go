@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Defaults for @csrf, see BladeConfig.CSRFLocalsKey and CSRFFieldName.
+const (
+	defaultCSRFLocalsKey = "csrf"
+	defaultCSRFFieldName = "_csrf"
+)
+
+// FormState holds the validation errors and old input of a request, read
+// by @error and old(). Templates receive it under the "_form" key, set by
+// WithFiberContext after Form or by WithForm.
+type FormState struct {
+	Errors map[string][]string
+	Old    map[string]string
+}
+
+// formLocalsKey is the Fiber Locals key Form stores the FormState under.
+const formLocalsKey = "blade.form"
+
+// Form returns the FormState of the request, creating it on first use
+// with the submitted form fields as old input. Handlers add validation
+// errors to it before rendering the form again.
+func Form(c *fiber.Ctx) *FormState {
+	if f, ok := c.Locals(formLocalsKey).(*FormState); ok {
+		return f
+	}
+	f := &FormState{Errors: map[string][]string{}, Old: map[string]string{}}
+	c.Request().PostArgs().VisitAll(func(k, v []byte) {
+		f.Old[string(k)] = string(v)
+	})
+	if mf, err := c.MultipartForm(); err == nil {
+		for k, vs := range mf.Value {
+			if len(vs) > 0 {
+				f.Old[k] = vs[0]
+			}
+		}
+	}
+	c.Locals(formLocalsKey, f)
+	return f
+}
+
+// WithForm returns data with form added as the request's FormState, for
+// rendering outside Fiber. It accepts the same data shapes as
+// WithFiberContext.
+func WithForm(data interface{}, form *FormState) map[string]interface{} {
+	return withEntry(data, "_form", form)
+}
+
+// AddError records a validation error for field.
+func (f *FormState) AddError(field, message string) {
+	if f.Errors == nil {
+		f.Errors = map[string][]string{}
+	}
+	f.Errors[field] = append(f.Errors[field], message)
+}
+
+// HasErrors reports whether any field has a validation error.
+func (f *FormState) HasErrors() bool {
+	return f != nil && len(f.Errors) > 0
+}
+
+// SetCSRF sets the Fiber Locals key @csrf reads the token from, the key
+// the csrf middleware is configured with as ContextKey, and the name of
+// the hidden field. Empty values keep the defaults "csrf" and "_csrf".
+func (c *Compiler) SetCSRF(localsKey, fieldName string) {
+	c.extMu.Lock()
+	defer c.extMu.Unlock()
+	c.csrfKey, c.csrfField = localsKey, fieldName
+}
+
+// csrfInput renders @csrf: a hidden input holding the request's CSRF
+// token, or nothing when the request has none.
+func (c *Compiler) csrfInput(root interface{}) template.HTML {
+	c.extMu.RLock()
+	key, field := c.csrfKey, c.csrfField
+	c.extMu.RUnlock()
+	if key == "" {
+		key = defaultCSRFLocalsKey
+	}
+	if field == "" {
+		field = defaultCSRFFieldName
+	}
+	m, _ := root.(map[string]interface{})
+	fc, _ := m["_fiber"].(FiberAccessor)
+	if fc == nil {
+		return ""
+	}
+	token, _ := fc.Local(key).(string)
+	if token == "" {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(field) +
+		`" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
+// methodInput renders @method('PUT'), the hidden _method field for
+// method spoofing.
+func methodInput(method string) template.HTML {
+	return template.HTML(`<input type="hidden" name="_method" value="` +
+		template.HTMLEscapeString(strings.ToUpper(method)) + `">`)
+}
+
+// formState returns the FormState found in the root data, or nil.
+func formState(root interface{}) *FormState {
+	m, _ := root.(map[string]interface{})
+	f, _ := m["_form"].(*FormState)
+	return f
+}
+
+// formError returns the first validation error of field, or "", for
+// @error('field').
+func formError(root interface{}, field string) string {
+	if f := formState(root); f != nil && len(f.Errors[field]) > 0 {
+		return f.Errors[field][0]
+	}
+	return ""
+}
+
+// rootFuncs are the built-in functions that read the request state from
+// the root data, see Compiler.takesRoot.
+var rootFuncs = map[string]bool{"old": true}
+
+// takesRoot reports whether a call of the function name gets the root data
+// as its first argument: old('email') lowers to old $ "email". A function
+// the application registers under the same name replaces the built-in and
+// is called as written.
+func (c *Compiler) takesRoot(name string) bool {
+	if !rootFuncs[name] {
+		return false
+	}
+	c.extMu.RLock()
+	defer c.extMu.RUnlock()
+	_, replaced := c.userFuncs[name]
+	return !replaced
+}
+
+// old returns the old input of field, or the default when there is none:
+// old('email') or old('email', $user->email).
+func old(root interface{}, field string, def ...interface{}) interface{} {
+	if f := formState(root); f != nil {
+		if v, ok := f.Old[field]; ok {
+			return v
+		}
+	}
+	if len(def) > 0 {
+		return def[0]
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/csrf"
+)
+
+const formPage = `<form method="POST">@csrf @method('put')
+<input name="email" value="{{ old('email') }}">@error('email')<p class="err">{{ $message }}</p>@else<p>ok</p>@enderror
+<input name="name" value="{{ old('name', $user['name']) }}">
+</form>`
+
+func TestFormDirectives(t *testing.T) {
+	form := &FormState{Old: map[string]string{"email": `a"b@x`}}
+	form.AddError("email", "The email is <invalid>.")
+	form.AddError("email", "second")
+	out := renderPage(t, map[string]string{"pages/form.blade.tpl": formPage}, "pages/form.blade.tpl",
+		WithForm(map[string]interface{}{"user": map[string]interface{}{"name": "Al"}}, form))
+	for _, want := range []string{
+		`<input type="hidden" name="_method" value="PUT">`,
+		`<input name="email" value="a&#34;b@x">`,
+		`<p class="err">The email is &lt;invalid&gt;.</p>`,
+		`<input name="name" value="Al">`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "_csrf") || strings.Contains(out, "<p>ok</p>") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	out = renderPage(t, map[string]string{"pages/form.blade.tpl": formPage}, "pages/form.blade.tpl",
+		map[string]interface{}{"user": map[string]interface{}{"name": "Al"}})
+	if !strings.Contains(out, `<input name="email" value="">`) || !strings.Contains(out, "<p>ok</p>") {
+		t.Errorf("expected empty old input and no error without a FormState:\n%s", out)
+	}
+}
+
+func TestFormDirectivesWithFiber(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "pages/form.blade.tpl", formPage)
+	be := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, Development: true, CSRFLocalsKey: "token", CSRFFieldName: "_token"})
+	adapter := &FiberViewsAdapter{Engine: be}
+
+	app := fiber.New()
+	app.Use(csrf.New(csrf.Config{KeyLookup: "form:_token", ContextKey: "token"}))
+	data := map[string]interface{}{"user": map[string]interface{}{"name": "Al"}}
+	app.Get("/form", func(c *fiber.Ctx) error {
+		return adapter.RenderWithCtx(c, "pages/form.blade.tpl", data)
+	})
+	app.Post("/form", func(c *fiber.Ctx) error {
+		if !strings.Contains(c.FormValue("email"), "@") {
+			Form(c).AddError("email", "Enter an email address.")
+		}
+		return adapter.RenderWithCtx(c, "pages/form.blade.tpl", data)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/form", nil), 5000)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	m := regexp.MustCompile(`<input type="hidden" name="_token" value="([^"]+)">`).FindStringSubmatch(string(body))
+	if m == nil {
+		t.Fatalf("expected a CSRF field in the form:\n%s", body)
+	}
+
+	form := url.Values{"_token": {m[1]}, "email": {"nope"}, "name": {"Bo"}}
+	req := httptest.NewRequest("POST", "/form", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, ck := range resp.Cookies() {
+		req.AddCookie(ck)
+	}
+	resp, err = app.Test(req, 5000)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`<input name="email" value="nope">`,
+		`<p class="err">Enter an email address.</p>`,
+		`<input name="name" value="Bo">`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %s in the response (%d):\n%s", want, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestUserFuncReplacesOld(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "pages/p.blade.tpl", `{{ old('email') }}`)
+	be := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, Development: true, Funcs: map[string]interface{}{
+		"old": func(s string) string { return "was " + s },
+	}})
+	out, err := be.RenderString("pages/p.blade.tpl", WithForm(nil, &FormState{Old: map[string]string{"email": "x"}}))
+	if err != nil || out != "was email" {
+		t.Fatalf("expected the registered old to be called as written, got %q, %v", out, err)
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var fragmentFiles = map[string]string{
+	"layouts/app.blade.tpl": `<html><body>@yield('content')</body></html>`,
+	"pages/users.blade.tpl": `@extends('layouts/app.blade.tpl')
+@section('content')
+<h1>{{ $title }}</h1>
+@fragment('list')<table>
+@foreach($users as $user)
+@fragment('row')<tr id="u{{ $user['id'] }}"><td>{{ $user['name'] }}</td><td>{{ $loop->iteration }}/{{ $title }}</td></tr>@endfragment
+@endforeach
+</table>@endfragment
+@endsection`,
+}
+
+func fragmentData() map[string]interface{} {
+	return map[string]interface{}{
+		"title": "Users",
+		"users": []map[string]interface{}{{"id": 1, "name": "Al"}, {"id": 2, "name": "Bo"}},
+	}
+}
+
+func TestFragmentsRenderInPlace(t *testing.T) {
+	out, err := newEngine(t, fragmentFiles, cachedConfig).RenderString("pages/users.blade.tpl", fragmentData())
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for _, want := range []string{
+		`<html><body>`,
+		`<h1>Users</h1>`,
+		`<tr id="u1"><td>Al</td><td>1/Users</td></tr>`,
+		`<tr id="u2"><td>Bo</td><td>2/Users</td></tr>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderFragment(t *testing.T) {
+	be := newEngine(t, fragmentFiles, cachedConfig)
+	var buf bytes.Buffer
+	if err := be.RenderFragment(&buf, "pages/users.blade.tpl", "list", fragmentData()); err != nil {
+		t.Fatalf("render list: %v", err)
+	}
+	if out := buf.String(); !strings.HasPrefix(out, "<table>") || !strings.HasSuffix(out, "</table>") || !strings.Contains(out, `<tr id="u2">`) {
+		t.Errorf("expected only the table:\n%s", out)
+	}
+
+	buf.Reset()
+	row := map[string]interface{}{"title": "Users", "user": map[string]interface{}{"id": 3, "name": "Cy"}, "loop": map[string]interface{}{"iteration": 3}}
+	if err := be.RenderFragment(&buf, "pages/users.blade.tpl", "row", row); err != nil {
+		t.Fatalf("render row: %v", err)
+	}
+	if want := `<tr id="u3"><td>Cy</td><td>3/Users</td></tr>`; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	err := be.RenderFragment(&buf, "pages/users.blade.tpl", "nope", row)
+	if !errors.Is(err, ErrFragmentNotFound) {
+		t.Errorf("expected ErrFragmentNotFound, got %v", err)
+	}
+}
+
+func TestFragmentDefinedTwice(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	_, err := c.CompileString(`@fragment('a')x @endfragment @fragment('a')y @endfragment`, "inline.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), `fragment "a" is defined twice`) {
+		t.Fatalf("expected a duplicate fragment error, got %v", err)
+	}
+}
+
+func TestRenderFragmentWithCtx(t *testing.T) {
+	adapter := &FiberViewsAdapter{Engine: newEngine(t, fragmentFiles, cachedConfig)}
+	app := fiber.New()
+	app.Get("/users", func(c *fiber.Ctx) error {
+		return adapter.RenderFragmentWithCtx(c, "pages/users.blade.tpl", fragmentData())
+	})
+
+	for target, want := range map[string]string{"list": "<table>", "": "<html>", "body": "<html>"} {
+		req := httptest.NewRequest("GET", "/users", nil)
+		if target != "" {
+			req.Header.Set("HX-Target", target)
+		}
+		if target == "body" {
+			req.Header.Set("HX-Boosted", "true")
+		}
+		resp, err := app.Test(req, 5000)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.HasPrefix(string(body), want) {
+			t.Errorf("HX-Target %q: expected the body to start with %s:\n%s", target, want, body)
+		}
+		if resp.Header.Get("Vary") != "HX-Target" {
+			t.Errorf("HX-Target %q: Vary = %q", target, resp.Header.Get("Vary"))
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("HX-Target", "sidebar")
+	resp, err := app.Test(req, 5000)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusInternalServerError || strings.Contains(string(body), "<html>") {
+		t.Errorf("expected an error for a target that is not a fragment, got %d:\n%s", resp.StatusCode, body)
+	}
+}
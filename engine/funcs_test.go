@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestConfigFuncsAndAddFunc(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "pages/a.blade.tpl", `<p>{{ shout $name }}</p>`)
+	writeTempTemplate(t, tmp, "pages/b.gohtml", `<p>{{ shout .name }} {{ wrap .name }}</p>`)
+
+	be := NewBladeEngineWithConfig(BladeConfig{
+		TemplatesDir:    tmp,
+		CacheEnabled:    true,
+		CacheMaxSizeMB:  1,
+		CacheTTLMinutes: 1,
+		Funcs:           template.FuncMap{"shout": strings.ToUpper},
+	})
+	data := map[string]interface{}{"name": "ann"}
+	out, err := be.RenderString("pages/a.blade.tpl", data)
+	if err != nil || out != "<p>ANN</p>" {
+		t.Fatalf("expected <p>ANN</p>, got %q (%v)", out, err)
+	}
+	if err := be.compiler.validateTemplateSyntax(`{{ shout "x" }}`); err != nil {
+		t.Fatalf("config funcs should be visible to validation: %v", err)
+	}
+
+	// b.gohtml failed to parse at startup; registering wrap must not leave a stale entry
+	be.AddFunc("wrap", func(s string) string { return "[" + s + "]" })
+	out, err = be.RenderString("pages/b.gohtml", data)
+	if err != nil || out != "<p>ANN [ann]</p>" {
+		t.Fatalf("expected <p>ANN [ann]</p>, got %q (%v)", out, err)
+	}
+
+	be.AddFunc("shout", strings.ToLower)
+	if out, _ := be.RenderString("pages/a.blade.tpl", data); out != "<p>ann</p>" {
+		t.Fatalf("expected the replaced func after AddFunc, got %q", out)
+	}
+}
+
+func TestHelpersAreRegistered(t *testing.T) {
+	out := renderBlade(t, `{{ upper $name }}|{{ number_format $n 2 }}|{{ nl2br $bio }}|{{ default $missing "n/a" }}`, map[string]interface{}{
+		"name": "ann", "n": 1234.5, "bio": "a<b>\nc",
+	})
+	if want := "ANN|1,234.50|a&lt;b&gt;<br>\nc|n/a"; out != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,222 @@
+package helpers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// First returns the first element of a slice, array or string, or nil when
+// it is empty.
+func First(coll interface{}) interface{} {
+	if s, ok := coll.(string); ok {
+		for _, r := range s {
+			return string(r)
+		}
+		return nil
+	}
+	items, _ := list(coll)
+	if len(items) == 0 {
+		return nil
+	}
+	return items[0]
+}
+
+// Last returns the last element of a slice, array or string, or nil when
+// it is empty.
+func Last(coll interface{}) interface{} {
+	if s, ok := coll.(string); ok {
+		if s == "" {
+			return nil
+		}
+		r, _ := utf8.DecodeLastRuneInString(s)
+		return string(r)
+	}
+	items, _ := list(coll)
+	if len(items) == 0 {
+		return nil
+	}
+	return items[len(items)-1]
+}
+
+// Count returns the number of elements of a slice, array or map, or the
+// number of characters of a string. nil counts as 0.
+func Count(coll interface{}) (int, error) {
+	if s, ok := coll.(string); ok {
+		return utf8.RuneCountInString(s), nil
+	}
+	v := indirect(reflect.ValueOf(coll))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0, nil
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return v.Len(), nil
+	}
+	return 0, fmt.Errorf("count: cannot count %T", coll)
+}
+
+// Keys returns the keys of a map in sorted order, or the indexes of a slice.
+func Keys(coll interface{}) []interface{} {
+	keys, _ := entries(coll)
+	return keys
+}
+
+// Values returns the values of a map in key order, or the elements of a slice.
+func Values(coll interface{}) []interface{} {
+	_, values := entries(coll)
+	return values
+}
+
+// SortBy returns the elements of coll sorted by key, a map key or struct
+// field (dotted paths reach nested values). Pass "desc" to reverse the order.
+func SortBy(coll interface{}, key string, order ...string) []interface{} {
+	items := Values(coll)
+	out := make([]interface{}, len(items))
+	copy(out, items)
+	desc := len(order) > 0 && strings.EqualFold(order[0], "desc")
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := field(out[i], key), field(out[j], key)
+		if desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+	return out
+}
+
+// GroupBy groups the elements of coll by the text of key.
+func GroupBy(coll interface{}, key string) map[string][]interface{} {
+	groups := map[string][]interface{}{}
+	for _, item := range Values(coll) {
+		k := toString(field(item, key))
+		groups[k] = append(groups[k], item)
+	}
+	return groups
+}
+
+// Pluck returns the value of key for every element of coll.
+func Pluck(coll interface{}, key string) []interface{} {
+	items := Values(coll)
+	out := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		out = append(out, field(item, key))
+	}
+	return out
+}
+
+// Chunk splits coll into slices of at most size elements.
+func Chunk(coll interface{}, size interface{}) ([][]interface{}, error) {
+	n, err := toInt(size)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("chunk: size must be positive, got %d", n)
+	}
+	items := Values(coll)
+	var out [][]interface{}
+	for len(items) > 0 {
+		end := n
+		if end > len(items) {
+			end = len(items)
+		}
+		out = append(out, items[:end:end])
+		items = items[end:]
+	}
+	return out, nil
+}
+
+// InArray reports whether haystack, a slice or array, has an element equal
+// to needle: in_array($x, ['a', 'b']).
+func InArray(needle, haystack interface{}) bool {
+	items, _ := list(haystack)
+	for _, item := range items {
+		if item == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the elements of a slice or array.
+func list(coll interface{}) ([]interface{}, bool) {
+	v := indirect(reflect.ValueOf(coll))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	out := make([]interface{}, v.Len())
+	for i := range out {
+		out[i] = v.Index(i).Interface()
+	}
+	return out, true
+}
+
+// entries returns the keys and values of a map in sorted key order, or the
+// indexes and elements of a slice or array.
+func entries(coll interface{}) (keys, values []interface{}) {
+	v := indirect(reflect.ValueOf(coll))
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			keys = append(keys, i)
+			values = append(values, v.Index(i).Interface())
+		}
+	case reflect.Map:
+		mk := v.MapKeys()
+		sort.Slice(mk, func(i, j int) bool { return less(mk[i].Interface(), mk[j].Interface()) })
+		for _, k := range mk {
+			keys = append(keys, k.Interface())
+			values = append(values, v.MapIndex(k).Interface())
+		}
+	}
+	return keys, values
+}
+
+// field reads a map key or struct field from item; a dotted key walks
+// nested values. Missing keys give nil.
+func field(item interface{}, key string) interface{} {
+	cur := item
+	for _, part := range strings.Split(key, ".") {
+		v := indirect(reflect.ValueOf(cur))
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil
+			}
+			mv := v.MapIndex(reflect.ValueOf(part).Convert(v.Type().Key()))
+			if !mv.IsValid() {
+				return nil
+			}
+			cur = mv.Interface()
+		case reflect.Struct:
+			f := v.FieldByName(part)
+			if !f.IsValid() || !f.CanInterface() {
+				return nil
+			}
+			cur = f.Interface()
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+// less orders two values: numbers numerically, everything else as text.
+// nil sorts first.
+func less(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+	fa, errA := toFloat(a)
+	fb, errB := toFloat(b)
+	if errA == nil && errB == nil && !isString(a) && !isString(b) {
+		return fa < fb
+	}
+	return toString(a) < toString(b)
+}
+
+func isString(v interface{}) bool {
+	return indirect(reflect.ValueOf(v)).Kind() == reflect.String
+}
@@ -0,0 +1,120 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// now is the clock used by Ago; tests replace it.
+var now = time.Now
+
+// layouts are the named layouts accepted by Date besides Go layouts.
+var layouts = map[string]string{
+	"date":     "2006-01-02",
+	"datetime": "2006-01-02 15:04:05",
+	"time":     "15:04",
+	"rfc3339":  time.RFC3339,
+	"rfc1123":  time.RFC1123,
+	"kitchen":  time.Kitchen,
+	"long":     "January 2, 2006",
+	"short":    "Jan 2, 2006",
+}
+
+// parseLayouts are tried, in order, when a date is given as a string.
+var parseLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// Date formats t with a Go layout or one of the names date, datetime,
+// time, rfc3339, rfc1123, kitchen, long and short; the default is date.
+// t may be a time.Time, a Unix timestamp or a string in RFC 3339 or
+// "2006-01-02 15:04:05" form. A nil or zero time formats as "".
+func Date(t interface{}, layout ...string) (string, error) {
+	tm, err := toTime(t)
+	if err != nil || tm.IsZero() {
+		return "", err
+	}
+	l := "date"
+	if len(layout) > 0 && layout[0] != "" {
+		l = layout[0]
+	}
+	if named, ok := layouts[strings.ToLower(l)]; ok {
+		l = named
+	}
+	return tm.Format(l), nil
+}
+
+// Ago describes t relative to now, e.g. "3 minutes ago" or "in 2 days".
+func Ago(t interface{}) (string, error) {
+	tm, err := toTime(t)
+	if err != nil || tm.IsZero() {
+		return "", err
+	}
+	d := now().Sub(tm)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	if d < 45*time.Second {
+		return "just now", nil
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, u := range units {
+		if d < u.size {
+			continue
+		}
+		n := int(math.Round(float64(d) / float64(u.size)))
+		phrase := fmt.Sprintf("%d %s", n, u.name)
+		if n != 1 {
+			phrase += "s"
+		}
+		if future {
+			return "in " + phrase, nil
+		}
+		return phrase + " ago", nil
+	}
+	if future {
+		return "in 1 minute", nil
+	}
+	return "1 minute ago", nil
+}
+
+// toTime converts the values accepted by Date to a time.Time.
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t == nil {
+			return time.Time{}, nil
+		}
+		return *t, nil
+	case string:
+		if t == "" {
+			return time.Time{}, nil
+		}
+		for _, l := range parseLayouts {
+			if tm, err := time.Parse(l, t); err == nil {
+				return tm, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as a date", t)
+	}
+	sec, err := toInt(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a time, got %T", v)
+	}
+	return time.Unix(int64(sec), 0), nil
+}
@@ -0,0 +1,212 @@
+// Package helpers is the standard function library available to Blade
+// templates: string, number, date and collection helpers.
+//
+// The value a helper works on always comes first, so a Blade call reads
+// like its PHP counterpart: {{ truncate($post->body, 80) }} compiles to
+// truncate .post.body 80.
+package helpers
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Funcs returns the helpers by template name.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		// strings
+		"upper":      Upper,
+		"lower":      Lower,
+		"title":      Title,
+		"truncate":   Truncate,
+		"limit":      Truncate,
+		"slug":       Slug,
+		"replace":    Replace,
+		"contains":   Contains,
+		"startsWith": StartsWith,
+		"endsWith":   EndsWith,
+		"nl2br":      Nl2br,
+		// JavaScript
+		"json":   JSON,
+		"jsFrom": JsFrom,
+		// numbers
+		"number_format": NumberFormat,
+		"currency":      Currency,
+		"money":         Currency,
+		"percent":       Percent,
+		"filesize":      FileSize,
+		// dates
+		"date":          Date,
+		"ago":           Ago,
+		"diffForHumans": Ago,
+		// collections
+		"first":    First,
+		"last":     Last,
+		"count":    Count,
+		"keys":     Keys,
+		"values":   Values,
+		"sortBy":   SortBy,
+		"groupBy":  GroupBy,
+		"pluck":    Pluck,
+		"chunk":    Chunk,
+		"in_array": InArray,
+		// values
+		"default":  Default,
+		"coalesce": Coalesce,
+		"ternary":  Ternary,
+		"dig":      Dig,
+		// operators of the expression language
+		"add":          Add,
+		"sub":          Sub,
+		"mul":          Mul,
+		"div":          Div,
+		"mod":          Mod,
+		"concat":       Concat,
+		"nullCoalesce": NullCoalesce,
+		"equal":        Equal,
+		"notEqual":     NotEqual,
+		"identical":    Identical,
+		"notIdentical": NotIdentical,
+		"less":         Less,
+		"lessEqual":    LessEqual,
+		"greater":      Greater,
+		"greaterEqual": GreaterEqual,
+	}
+}
+
+// Default returns v, or def when v is empty (nil, zero, "" or an empty
+// collection).
+func Default(v, def interface{}) interface{} {
+	if empty(v) {
+		return def
+	}
+	return v
+}
+
+// Coalesce returns the first non-empty value, or nil.
+func Coalesce(vals ...interface{}) interface{} {
+	for _, v := range vals {
+		if !empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Ternary returns a when cond is true in the template sense, b otherwise.
+func Ternary(cond, a, b interface{}) interface{} {
+	if empty(cond) {
+		return b
+	}
+	return a
+}
+
+// Dig follows keys through maps, struct fields and methods, and slice
+// indexes, and returns the value found or nil when a step is missing. The
+// left side of ?? is lowered to it, so $user->name ?? 'guest' does not
+// fail when user is not set, even with missingkey=error.
+func Dig(v interface{}, keys ...interface{}) interface{} {
+	cur := v
+	for _, k := range keys {
+		rv := indirect(reflect.ValueOf(cur))
+		switch rv.Kind() {
+		case reflect.Map:
+			kt := rv.Type().Key()
+			kv := reflect.ValueOf(k)
+			if kt.Kind() == reflect.String {
+				kv = reflect.ValueOf(toString(k))
+			}
+			if !kv.IsValid() || !kv.Type().ConvertibleTo(kt) {
+				return nil
+			}
+			mv := rv.MapIndex(kv.Convert(kt))
+			if !mv.IsValid() {
+				return nil
+			}
+			cur = mv.Interface()
+		case reflect.Struct:
+			name := toString(k)
+			if f := rv.FieldByName(name); f.IsValid() && f.CanInterface() {
+				cur = f.Interface()
+				continue
+			}
+			m := reflect.ValueOf(cur).MethodByName(name)
+			if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() == 0 {
+				return nil
+			}
+			cur = m.Call(nil)[0].Interface()
+		case reflect.Slice, reflect.Array:
+			i, err := toInt(k)
+			if err != nil || i < 0 || i >= rv.Len() {
+				return nil
+			}
+			cur = rv.Index(i).Interface()
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+// empty reports whether v is false in the template sense.
+func empty(v interface{}) bool {
+	truth, _ := template.IsTrue(v)
+	return !truth
+}
+
+// toString renders a value as text; nil renders empty.
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case template.HTML:
+		return string(s)
+	case fmt.Stringer:
+		return s.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// toFloat converts a number or numeric string to float64.
+func toFloat(v interface{}) (float64, error) {
+	rv := indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return 0, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected a number, got %q", rv.String())
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+// toInt converts a number or numeric string to int.
+func toInt(v interface{}) (int, error) {
+	f, err := toFloat(v)
+	return int(f), err
+}
+
+// indirect dereferences pointers and interfaces; nil stays invalid.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
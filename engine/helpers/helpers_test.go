@@ -0,0 +1,215 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStringHelpers(t *testing.T) {
+	trunc, _ := Truncate("The quick brown fox", 10)
+	cases := []struct{ got, want interface{} }{
+		{Upper("abc"), "ABC"},
+		{Lower("ÀB"), "àb"},
+		{Title("hello big-world"), "Hello Big-World"},
+		{trunc, "The quick..."},
+		{Slug("  Hello, World! 2024 "), "hello-world-2024"},
+		{Slug("a b", "_"), "a_b"},
+		{Replace("a-b-c", "-", "+"), "a+b+c"},
+		{Contains("haystack", "st"), true},
+		{Contains([]string{"a", "b"}, "b"), true},
+		{StartsWith("prefix", "pre"), true},
+		{EndsWith("suffix", "fix"), true},
+		{string(Nl2br("a<b>\nc")), "a&lt;b&gt;<br>\nc"},
+	}
+	for i, c := range cases {
+		if c.got != c.want {
+			t.Errorf("case %d: got %#v, want %#v", i, c.got, c.want)
+		}
+	}
+}
+
+func TestNumberHelpers(t *testing.T) {
+	cases := []struct {
+		fn   func() (string, error)
+		want string
+	}{
+		{func() (string, error) { return NumberFormat(1234567.891, 2) }, "1,234,567.89"},
+		{func() (string, error) { return NumberFormat(-1234.5) }, "-1,235"},
+		{func() (string, error) { return NumberFormat("1234.5", 1, ",", ".") }, "1.234,5"},
+		{func() (string, error) { return Currency(1234.5) }, "$1,234.50"},
+		{func() (string, error) { return Currency(-3, "eur") }, "-€3.00"},
+		{func() (string, error) { return Currency(50000, "VND") }, "50,000 ₫"},
+		{func() (string, error) { return Currency(10, "CHF") }, "CHF 10.00"},
+		{func() (string, error) { return Percent(12.345, 1) }, "12.3%"},
+		{func() (string, error) { return FileSize(1536, 1) }, "1.5 KB"},
+		{func() (string, error) { return FileSize(512) }, "512 B"},
+	}
+	for i, c := range cases {
+		got, err := c.fn()
+		if err != nil || got != c.want {
+			t.Errorf("case %d: got %q (%v), want %q", i, got, err, c.want)
+		}
+	}
+	if _, err := NumberFormat("abc"); err == nil {
+		t.Error("expected an error for a non-numeric string")
+	}
+}
+
+func TestDateHelpers(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 14, 7, 0, 0, time.UTC)
+	for _, c := range []struct {
+		in     interface{}
+		layout string
+		want   string
+	}{
+		{ts, "", "2024-03-05"},
+		{ts, "long", "March 5, 2024"},
+		{ts, "02/01/2006 15:04", "05/03/2024 14:07"},
+		{"2024-03-05 14:07:00", "datetime", "2024-03-05 14:07:00"},
+		{nil, "", ""},
+	} {
+		if got, err := Date(c.in, c.layout); err != nil || got != c.want {
+			t.Errorf("Date(%v, %q) = %q (%v), want %q", c.in, c.layout, got, err, c.want)
+		}
+	}
+
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return ts }
+	for _, c := range []struct {
+		in   time.Time
+		want string
+	}{
+		{ts.Add(-10 * time.Second), "just now"},
+		{ts.Add(-3 * time.Minute), "3 minutes ago"},
+		{ts.Add(-25 * time.Hour), "1 day ago"},
+		{ts.Add(2 * 7 * 24 * time.Hour), "in 2 weeks"},
+	} {
+		if got, _ := Ago(c.in); got != c.want {
+			t.Errorf("Ago(%v) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+type person struct {
+	Name string
+	Age  int
+	Team string
+}
+
+func TestCollectionHelpers(t *testing.T) {
+	people := []person{{"Cy", 40, "b"}, {"Al", 30, "a"}, {"Bo", 35, "a"}}
+	m := map[string]int{"b": 2, "a": 1}
+
+	if First(people) != people[0] || Last(people) != people[2] || First([]int{}) != nil || Last("héé") != "é" {
+		t.Error("first/last")
+	}
+	if n, _ := Count(m); n != 2 {
+		t.Errorf("count: %d", n)
+	}
+	if got := Keys(m); !reflect.DeepEqual(got, []interface{}{"a", "b"}) {
+		t.Errorf("keys: %v", got)
+	}
+	if got := Values(m); !reflect.DeepEqual(got, []interface{}{1, 2}) {
+		t.Errorf("values: %v", got)
+	}
+	if got := Pluck(SortBy(people, "Age"), "Name"); !reflect.DeepEqual(got, []interface{}{"Al", "Bo", "Cy"}) {
+		t.Errorf("sortBy: %v", got)
+	}
+	if got := Pluck(SortBy(people, "Name", "desc"), "Name"); !reflect.DeepEqual(got, []interface{}{"Cy", "Bo", "Al"}) {
+		t.Errorf("sortBy desc: %v", got)
+	}
+	if got := GroupBy(people, "Team"); len(got["a"]) != 2 || len(got["b"]) != 1 {
+		t.Errorf("groupBy: %v", got)
+	}
+	rows := []map[string]interface{}{{"user": map[string]interface{}{"id": 1}}, {"user": map[string]interface{}{"id": 2}}}
+	if got := Pluck(rows, "user.id"); !reflect.DeepEqual(got, []interface{}{1, 2}) {
+		t.Errorf("pluck nested: %v", got)
+	}
+	if got, _ := Chunk([]int{1, 2, 3, 4, 5}, 2); len(got) != 3 || len(got[2]) != 1 {
+		t.Errorf("chunk: %v", got)
+	}
+	if !InArray("b", []string{"a", "b"}) || InArray("c", []interface{}{"a"}) || InArray("a", "abc") {
+		t.Error("in_array")
+	}
+}
+
+func TestValueHelpers(t *testing.T) {
+	if Default("", "n/a") != "n/a" || Default(0, 5) != 5 || Default("x", "n/a") != "x" {
+		t.Error("default")
+	}
+	if Coalesce(nil, "", "a", "b") != "a" || Coalesce() != nil {
+		t.Error("coalesce")
+	}
+	if Ternary(true, "y", "n") != "y" || Ternary([]int{}, "y", "n") != "n" {
+		t.Error("ternary")
+	}
+	data := map[string]interface{}{"user": &person{Name: "Al"}, "ids": []int{7}, "n": map[int]string{1: "one"}}
+	if Dig(data, "user", "Name") != "Al" || Dig(data, "ids", 0) != 7 || Dig(data, "n", 1) != "one" ||
+		Dig(data, "user", "Nope") != nil || Dig(data, "missing", "x") != nil || Dig(data, "ids", 5) != nil {
+		t.Error("dig")
+	}
+}
+
+func TestArithmeticHelpers(t *testing.T) {
+	if v, _ := Add(1, 2); v != 3 {
+		t.Errorf("add ints: %#v", v)
+	}
+	if v, _ := Add(1, 0.5); v != 1.5 {
+		t.Errorf("add float: %#v", v)
+	}
+	if v, _ := Add("a", 1); v != "a1" {
+		t.Errorf("add text: %#v", v)
+	}
+	if v, _ := Div(6, 3); v != 2 {
+		t.Errorf("div exact: %#v", v)
+	}
+	if _, err := Div(1, 0); err == nil {
+		t.Error("expected division by zero")
+	}
+	if _, err := Mul("x", 2); err == nil {
+		t.Error("expected an error for a non-numeric operand")
+	}
+	if NullCoalesce(0, 5) != 0 || NullCoalesce(nil, 5) != 5 {
+		t.Error("nullCoalesce")
+	}
+}
+
+func TestComparisonHelpers(t *testing.T) {
+	if !Equal(3, 3.0) || !Equal(int64(3), "3") || !Equal("a", "a") || !Equal(nil, nil) || !Equal(true, true) {
+		t.Error("equal")
+	}
+	if Equal(0, nil) || Equal("1", "a") || !NotEqual(1, 2) {
+		t.Error("not equal")
+	}
+	if !Identical(3, 3.0) || !Identical("a", "a") || Identical(3, "3") || Identical(0, nil) || !NotIdentical("1", 1) {
+		t.Error("identical")
+	}
+	if ok, err := Greater(2.5, 2); !ok || err != nil {
+		t.Errorf("greater float/int: %v %v", ok, err)
+	}
+	if ok, err := LessEqual("10", 9.5); ok || err != nil {
+		t.Errorf("lessEqual numeric string: %v %v", ok, err)
+	}
+	if ok, err := Less("apple", "banana"); !ok || err != nil {
+		t.Errorf("less strings: %v %v", ok, err)
+	}
+	if _, err := GreaterEqual("a", 1); err == nil {
+		t.Error("expected an error ordering text and a number")
+	}
+}
+
+func TestJSONHelpers(t *testing.T) {
+	if js, err := JSON(map[string]int{"a": 1}); err != nil || js != `{"a":1}` {
+		t.Errorf("json: %q (%v)", js, err)
+	}
+	if js, _ := JsFrom([]string{"it's"}); js != `JSON.parse('[\"it\'s\"]')` {
+		t.Errorf("jsFrom list: %q", js)
+	}
+	if js, _ := JsFrom("x"); js != `"x"` {
+		t.Errorf("jsFrom string: %q", js)
+	}
+	if _, err := JSON(func() {}); err == nil {
+		t.Error("expected an error for a value JSON cannot encode")
+	}
+}
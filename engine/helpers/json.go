@@ -0,0 +1,34 @@
+package helpers
+
+import (
+	"encoding/json"
+	"html/template"
+	"reflect"
+)
+
+// JSON encodes v as JSON for @json. The result has type template.JS, so in
+// a <script> it is written as is and elsewhere, such as an attribute, it
+// is escaped for its context. encoding/json already escapes <, > and &, so
+// the output cannot close the script element.
+func JSON(v interface{}) (template.JS, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(b), nil
+}
+
+// JsFrom is Laravel's Js::from: objects and arrays become a
+// JSON.parse('...') call with the JSON in a single quoted string, which is
+// valid JavaScript in any position; other values are plain JSON.
+func JsFrom(v interface{}) (template.JS, error) {
+	js, err := JSON(v)
+	if err != nil {
+		return "", err
+	}
+	switch indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return template.JS("JSON.parse('" + template.JSEscapeString(string(js)) + "')"), nil
+	}
+	return js, nil
+}
@@ -0,0 +1,252 @@
+package helpers
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// The helpers in this file back the operators of the expression language:
+// $a + $b compiles to add .a .b, $a ?? 'x' to nullCoalesce .a "x".
+
+// Add returns a + b. Integers stay integers; a float operand makes the
+// result a float. A non-numeric string operand concatenates instead.
+func Add(a, b interface{}) (interface{}, error) {
+	if isText(a) || isText(b) {
+		return toString(a) + toString(b), nil
+	}
+	return arith("+", a, b)
+}
+
+// Sub returns a - b.
+func Sub(a, b interface{}) (interface{}, error) {
+	return arith("-", a, b)
+}
+
+// Mul returns a * b.
+func Mul(a, b interface{}) (interface{}, error) {
+	return arith("*", a, b)
+}
+
+// Div returns a / b. Integer division that leaves a remainder gives a
+// float, as in PHP; dividing by zero is an error.
+func Div(a, b interface{}) (interface{}, error) {
+	return arith("/", a, b)
+}
+
+// Mod returns the integer remainder of a / b.
+func Mod(a, b interface{}) (interface{}, error) {
+	x, err := toInt(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toInt(b)
+	if err != nil {
+		return nil, err
+	}
+	if y == 0 {
+		return nil, fmt.Errorf("modulo by zero")
+	}
+	return x % y, nil
+}
+
+// Concat joins the text of its arguments.
+func Concat(vals ...interface{}) string {
+	var b strings.Builder
+	for _, v := range vals {
+		b.WriteString(toString(v))
+	}
+	return b.String()
+}
+
+// NullCoalesce returns v unless it is nil, then def. Unlike Default, zero
+// values such as 0 and "" are kept.
+func NullCoalesce(v, def interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if v == nil || (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface || rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice) && rv.IsNil() {
+		return def
+	}
+	return v
+}
+
+// Equal reports whether a == b. Numbers and numeric strings compare by
+// value whatever their Go types, so 3, 3.0 and "3" are equal; nil only
+// equals nil.
+func Equal(a, b interface{}) bool {
+	if an, bn := isNil(a), isNil(b); an || bn {
+		return an && bn
+	}
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(indirect(reflect.ValueOf(a)).Interface(), indirect(reflect.ValueOf(b)).Interface())
+}
+
+// NotEqual reports whether a != b.
+func NotEqual(a, b interface{}) bool {
+	return !Equal(a, b)
+}
+
+// Identical reports whether a === b: like Equal, but numeric strings are
+// not numbers, so 3 and "3" differ. Numbers still compare by value
+// whatever their Go types, since JSON data decodes every number as float64.
+func Identical(a, b interface{}) bool {
+	if an, bn := isNil(a), isNil(b); an || bn {
+		return an && bn
+	}
+	if isString(a) || isString(b) {
+		return isString(a) && isString(b) && toString(a) == toString(b)
+	}
+	return Equal(a, b)
+}
+
+// NotIdentical reports whether a !== b.
+func NotIdentical(a, b interface{}) bool {
+	return !Identical(a, b)
+}
+
+// Less reports whether a < b.
+func Less(a, b interface{}) (bool, error) {
+	c, err := order(a, b)
+	return c < 0, err
+}
+
+// LessEqual reports whether a <= b.
+func LessEqual(a, b interface{}) (bool, error) {
+	c, err := order(a, b)
+	return c <= 0, err
+}
+
+// Greater reports whether a > b.
+func Greater(a, b interface{}) (bool, error) {
+	c, err := order(a, b)
+	return c > 0, err
+}
+
+// GreaterEqual reports whether a >= b.
+func GreaterEqual(a, b interface{}) (bool, error) {
+	c, err := order(a, b)
+	return c >= 0, err
+}
+
+// order compares a and b for the ordering operators.
+func order(a, b interface{}) (int, error) {
+	c, ok := compare(a, b)
+	if !ok {
+		return 0, fmt.Errorf("incompatible types for comparison: %T and %T", a, b)
+	}
+	return c, nil
+}
+
+// compare orders numbers and numeric strings by value, with nil as 0, and
+// other strings by text. ok is false for any other pair.
+func compare(a, b interface{}) (int, bool) {
+	if numeric(a) && numeric(b) {
+		if x, ok := integer(a); ok {
+			if y, ok := integer(b); ok {
+				return cmp.Compare(x, y), true
+			}
+		}
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		return cmp.Compare(x, y), true
+	}
+	if isString(a) && isString(b) {
+		return strings.Compare(toString(a), toString(b)), true
+	}
+	return 0, false
+}
+
+// numeric reports whether v is nil, a number or a numeric string.
+func numeric(v interface{}) bool {
+	switch indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Invalid, reflect.String:
+		_, err := toFloat(v)
+		return err == nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isNil reports whether v is nil or a nil pointer.
+func isNil(v interface{}) bool {
+	return !indirect(reflect.ValueOf(v)).IsValid()
+}
+
+// arith applies op to two numbers.
+func arith(op string, a, b interface{}) (interface{}, error) {
+	ai, aInt := integer(a)
+	bi, bInt := integer(b)
+	if aInt && bInt {
+		switch op {
+		case "+":
+			return ai + bi, nil
+		case "-":
+			return ai - bi, nil
+		case "*":
+			return ai * bi, nil
+		case "/":
+			if bi == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if ai%bi == 0 {
+				return ai / bi, nil
+			}
+		}
+	}
+	x, err := toFloat(a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	y, err := toFloat(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return x / y, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %q", op)
+}
+
+// integer returns v as an int when it is an integer value or a whole
+// number in a numeric string. nil counts as 0.
+func integer(v interface{}) (int, bool) {
+	rv := indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return 0, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int(rv.Uint()), true
+	case reflect.String:
+		if f, err := toFloat(rv.String()); err == nil && f == math.Trunc(f) && !strings.ContainsAny(rv.String(), ".eE") {
+			return int(f), true
+		}
+	}
+	return 0, false
+}
+
+// isText reports whether v is a string that is not a number.
+func isText(v interface{}) bool {
+	if !isString(v) {
+		return false
+	}
+	_, err := toFloat(v)
+	return err != nil
+}
@@ -0,0 +1,134 @@
+package helpers
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// currencies holds the symbol and decimals used by Currency.
+var currencies = map[string]struct {
+	symbol   string
+	decimals int
+	suffix   bool // symbol written after the amount
+}{
+	"USD": {"$", 2, false},
+	"EUR": {"€", 2, false},
+	"GBP": {"£", 2, false},
+	"JPY": {"¥", 0, false},
+	"VND": {"₫", 0, true},
+}
+
+// NumberFormat formats n with grouped thousands like PHP's number_format:
+// number_format 1234.5 2 gives "1,234.50". The optional arguments are the
+// decimals (0 by default), the decimal point and the thousands separator.
+func NumberFormat(n interface{}, opts ...interface{}) (string, error) {
+	f, err := toFloat(n)
+	if err != nil {
+		return "", err
+	}
+	d := 0
+	if len(opts) > 0 {
+		if d, err = toInt(opts[0]); err != nil {
+			return "", err
+		}
+	}
+	point, thousands := ".", ","
+	if len(opts) > 1 {
+		point = toString(opts[1])
+	}
+	if len(opts) > 2 {
+		thousands = toString(opts[2])
+	}
+	return formatNumber(f, d, point, thousands), nil
+}
+
+func formatNumber(f float64, decimals int, point, thousands string) string {
+	if decimals < 0 {
+		decimals = 0
+	}
+	// round half away from zero like PHP; FormatFloat rounds half to even
+	scale := math.Pow(10, float64(decimals))
+	s := strconv.FormatFloat(math.Round(math.Abs(f)*scale)/scale, 'f', decimals, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(thousands)
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteString(point)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// Currency formats n as an amount of money in the given ISO code, USD by
+// default: currency 1234.5 gives "$1,234.50". Unknown codes are written
+// before the amount, e.g. "CHF 10.00".
+func Currency(n interface{}, code ...string) (string, error) {
+	f, err := toFloat(n)
+	if err != nil {
+		return "", err
+	}
+	c := "USD"
+	if len(code) > 0 && code[0] != "" {
+		c = strings.ToUpper(code[0])
+	}
+	cur, ok := currencies[c]
+	if !ok {
+		return c + " " + formatNumber(f, 2, ".", ","), nil
+	}
+	amount := formatNumber(math.Abs(f), cur.decimals, ".", ",")
+	sign := ""
+	if f < 0 && strings.Trim(amount, "0.,") != "" {
+		sign = "-"
+	}
+	if cur.suffix {
+		return sign + amount + " " + cur.symbol, nil
+	}
+	return sign + cur.symbol + amount, nil
+}
+
+// Percent formats n, already a percentage, with the given number of
+// decimals (0 by default): percent 12.345 1 gives "12.3%".
+func Percent(n interface{}, decimals ...interface{}) (string, error) {
+	f, err := toFloat(n)
+	if err != nil {
+		return "", err
+	}
+	d := 0
+	if len(decimals) > 0 {
+		if d, err = toInt(decimals[0]); err != nil {
+			return "", err
+		}
+	}
+	return formatNumber(f, d, ".", ",") + "%", nil
+}
+
+// FileSize formats a byte count with binary units: filesize 1536 1 gives
+// "1.5 KB". The precision defaults to 0.
+func FileSize(bytes interface{}, precision ...interface{}) (string, error) {
+	f, err := toFloat(bytes)
+	if err != nil {
+		return "", err
+	}
+	p := 0
+	if len(precision) > 0 {
+		if p, err = toInt(precision[0]); err != nil {
+			return "", err
+		}
+	}
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	i := 0
+	for math.Abs(f) >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return formatNumber(f, p, ".", ",") + " " + units[i], nil
+}
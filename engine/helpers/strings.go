@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"html/template"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Upper converts s to upper case.
+func Upper(s interface{}) string {
+	return strings.ToUpper(toString(s))
+}
+
+// Lower converts s to lower case.
+func Lower(s interface{}) string {
+	return strings.ToLower(toString(s))
+}
+
+// Title upper-cases the first letter of every word.
+func Title(s interface{}) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		out := r
+		if unicode.IsSpace(prev) || prev == '-' || prev == '_' {
+			out = unicode.ToTitle(r)
+		}
+		prev = r
+		return out
+	}, toString(s))
+}
+
+// Truncate shortens s to at most n characters followed by end, "..." by
+// default, like Laravel's Str::limit. Strings within the limit are returned
+// unchanged.
+func Truncate(s interface{}, n interface{}, end ...string) (string, error) {
+	str := toString(s)
+	limit, err := toInt(n)
+	if err != nil {
+		return "", err
+	}
+	if limit < 0 || utf8.RuneCountInString(str) <= limit {
+		return str, nil
+	}
+	suffix := "..."
+	if len(end) > 0 {
+		suffix = end[0]
+	}
+	return strings.TrimRightFunc(string([]rune(str)[:limit]), unicode.IsSpace) + suffix, nil
+}
+
+// Slug converts s to a lower-case URL slug: runs of anything other than
+// letters and digits become a single separator, "-" by default.
+func Slug(s interface{}, sep ...string) string {
+	separator := "-"
+	if len(sep) > 0 {
+		separator = sep[0]
+	}
+	var b strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(toString(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pending && b.Len() > 0 {
+				b.WriteString(separator)
+			}
+			pending = false
+			b.WriteRune(r)
+			continue
+		}
+		pending = true
+	}
+	return b.String()
+}
+
+// Replace replaces every occurrence of old in s with new.
+func Replace(s interface{}, old, new string) string {
+	return strings.ReplaceAll(toString(s), old, new)
+}
+
+// Contains reports whether s contains sub. For slices and arrays it
+// reports whether one of the elements equals sub.
+func Contains(s interface{}, sub interface{}) bool {
+	if items, ok := list(s); ok {
+		for _, item := range items {
+			if item == sub {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.Contains(toString(s), toString(sub))
+}
+
+// StartsWith reports whether s begins with prefix.
+func StartsWith(s interface{}, prefix string) bool {
+	return strings.HasPrefix(toString(s), prefix)
+}
+
+// EndsWith reports whether s ends with suffix.
+func EndsWith(s interface{}, suffix string) bool {
+	return strings.HasSuffix(toString(s), suffix)
+}
+
+// Nl2br escapes s and inserts <br> before each line break. The result is
+// HTML, so it is echoed as is.
+func Nl2br(s interface{}) template.HTML {
+	str := template.HTMLEscapeString(toString(s))
+	str = strings.ReplaceAll(str, "\r\n", "\n")
+	return template.HTML(strings.ReplaceAll(str, "\n", "<br>\n"))
+}
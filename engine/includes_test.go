@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIncludeWithDataAndScopedVariables(t *testing.T) {
+	files := map[string]string{
+		"components/card.blade.tpl": `<div class="card">{{ $title }}: {{ $item.Name }} ({{ $site }})</div>`,
+		"pages/home.blade.tpl":      `@foreach($products as $p)@include('components/card', ['title' => 'Product', 'item' => $p])@endforeach`,
+	}
+	data := map[string]interface{}{
+		"site":     "Shop",
+		"products": []map[string]interface{}{{"Name": "Pen"}, {"Name": "Ink"}},
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", data)
+	want := `<div class="card">Product: Pen (Shop)</div><div class="card">Product: Ink (Shop)</div>`
+	if out != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestIncludeDoesNotSeeParentLoopVariables(t *testing.T) {
+	files := map[string]string{
+		"components/row.blade.tpl": `[{{ $p }}]`,
+		"pages/home.blade.tpl":     `@foreach($list as $p)@include('components.row')@endforeach`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"list": []string{"a"}})
+	if out != "[]" {
+		t.Fatalf("loop variable leaked into include: %q", out)
+	}
+}
+
+func TestIncludeIfWhenAndFirst(t *testing.T) {
+	files := map[string]string{
+		"components/a.blade.tpl": `A{{ $n }}`,
+		"components/b.blade.tpl": `B`,
+		"pages/home.blade.tpl": `@includeIf('components/missing')` +
+			`@includeWhen($show, 'components/a', ['n' => 1])` +
+			`@includeWhen($hide, 'components/a')` +
+			`@includeFirst(['components/none', 'components/b'])`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"show": true, "hide": false})
+	if out != "A1B" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestEachRendersViewPerItemOrEmptyView(t *testing.T) {
+	files := map[string]string{
+		"components/li.blade.tpl":    `<li>{{ $key }}={{ $job }}</li>`,
+		"components/empty.blade.tpl": `<li>no jobs</li>`,
+		"pages/home.blade.tpl":       `<ul>@each('components/li', $jobs, 'job', 'components/empty')</ul>`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"jobs": []string{"x", "y"}})
+	if out != "<ul><li>0=x</li><li>1=y</li></ul>" {
+		t.Fatalf("got %q", out)
+	}
+	out = renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"jobs": []string{}})
+	if out != "<ul><li>no jobs</li></ul>" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestEachRawFallbackKeepsBracesAsText(t *testing.T) {
+	files := map[string]string{
+		"components/li.blade.tpl": `<li>{{ $job }}</li>`,
+		"pages/home.blade.tpl":    `<ul>@each('components/li', $jobs, 'job', 'raw|<li>none {{ $x }}</li>')</ul>`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"jobs": []string{}})
+	if out != "<ul><li>none {{ $x }}</li></ul>" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestRecursiveIncludeRendersTree(t *testing.T) {
+	files := map[string]string{
+		"components/node.blade.tpl": `({{ $node.Name }}@foreach($node.Children as $child)@include('components/node', ['node' => $child])@endforeach)`,
+		"pages/home.blade.tpl":      `@include('components/node', ['node' => $root])`,
+	}
+	root := map[string]interface{}{"Name": "a", "Children": []map[string]interface{}{
+		{"Name": "b", "Children": nil},
+	}}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"root": root})
+	if out != "(a(b))" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestRenderErrorInsideIncludeMapsToIncludedFile(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "components/user.blade.tpl", "<p>\n{{ $user.Nmae }}\n</p>")
+	writeTempTemplate(t, tmp, "pages/home.blade.tpl", "@include('components/user', ['user' => $u])")
+
+	be := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, Development: true})
+	_, err := be.RenderString("pages/home.blade.tpl", map[string]interface{}{"u": sourceMapUser{Name: "Ann"}})
+	var terr *TemplateError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected *TemplateError, got %v", err)
+	}
+	if terr.Location.File != "components/user.blade.tpl" || terr.Location.Line != 2 || !strings.Contains(terr.Message, "Nmae") {
+		t.Fatalf("expected error at components/user.blade.tpl:2, got %v", err)
+	}
+}
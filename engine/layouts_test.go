@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestThreeLevelLayoutInheritance(t *testing.T) {
+	files := map[string]string{
+		"layouts/base.blade.tpl": `<title>@yield('title', 'Site')</title>` +
+			`<nav>@section('nav')<a>home</a>@show</nav>` +
+			`<body>@yield('body')</body>`,
+		"layouts/docs.blade.tpl": `@extends('layouts/base.blade.tpl')
+@section('title', 'Docs')
+@section('nav')@parent<a>docs</a>@endsection
+@section('body')<aside>@yield('sidebar', 'no sidebar')</aside><main>@yield('content')</main>@endsection`,
+		"pages/intro.blade.tpl": `@extends('layouts/docs.blade.tpl')
+@section('title')Intro - @parent@endsection
+@section('nav')@parent<a>intro</a>@endsection
+@section('content')<h1>{{ $heading }}</h1>@endsection`,
+	}
+	out := renderPage(t, files, "pages/intro.blade.tpl", map[string]interface{}{"heading": "Hello"})
+	for _, want := range []string{
+		"<title>Intro - Docs</title>",
+		"<nav><a>home</a><a>docs</a><a>intro</a></nav>",
+		"<aside>no sidebar</aside><main><h1>Hello</h1></main>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestYieldDefaultAndShowWithoutOverride(t *testing.T) {
+	files := map[string]string{
+		"layouts/base.blade.tpl": `[@yield('title', 'Default & Co')][@section('aside')<i>aside</i>@show][@yield('missing')]`,
+		"pages/p.blade.tpl":      `@extends('layouts/base.blade.tpl')`,
+	}
+	out := renderPage(t, files, "pages/p.blade.tpl", nil)
+	if !strings.HasPrefix(out, "[Default &amp; Co][<i>aside</i>][]") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestYieldAndSectionLiteralsKeepBraces(t *testing.T) {
+	files := map[string]string{
+		"layouts/base.blade.tpl": `<title>@yield('title', 'Default {{ x }}')</title><p>@yield('body', '{{template "t"}}')</p>`,
+		"pages/p.blade.tpl":      `@extends('layouts/base.blade.tpl')`,
+		"pages/q.blade.tpl":      "@extends('layouts/base.blade.tpl')\n@section('body', 'a {{ $b }} c}')",
+	}
+	out := renderPage(t, files, "pages/p.blade.tpl", nil)
+	if !strings.Contains(out, "<title>Default {{ x }}</title><p>{{template &#34;t&#34;}}</p>") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	out = renderPage(t, files, "pages/q.blade.tpl", nil)
+	if !strings.Contains(out, "<p>a {{ $b }} c}</p>") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestHasSectionAndSectionMissing(t *testing.T) {
+	files := map[string]string{
+		"layouts/base.blade.tpl": `@hasSection('sidebar')<aside>@yield('sidebar')</aside>@else<p>full width</p>@endif` +
+			`@sectionMissing('footer')<footer>default footer</footer>@endif`,
+		"pages/with.blade.tpl":    "@extends('layouts/base.blade.tpl')\n@section('sidebar', 'links')",
+		"pages/without.blade.tpl": "@extends('layouts/base.blade.tpl')\n@section('footer', 'custom')",
+	}
+	out := renderPage(t, files, "pages/with.blade.tpl", nil)
+	if !strings.Contains(out, "<aside>links</aside><footer>default footer</footer>") {
+		t.Fatalf("unexpected output with sidebar: %q", out)
+	}
+	out = renderPage(t, files, "pages/without.blade.tpl", nil)
+	if !strings.Contains(out, "<p>full width</p>") || strings.Contains(out, "default footer") {
+		t.Fatalf("unexpected output without sidebar: %q", out)
+	}
+}
+
+func TestSectionAppendKeepsParentContent(t *testing.T) {
+	files := map[string]string{
+		"layouts/base.blade.tpl": `<head>@section('scripts')<script src="app.js"></script>@show</head>`,
+		"pages/p.blade.tpl":      "@extends('layouts/base.blade.tpl')\n@section('scripts')<script src=\"page.js\"></script>@append",
+	}
+	out := renderPage(t, files, "pages/p.blade.tpl", nil)
+	if !strings.Contains(out, `<head><script src="app.js"></script><script src="page.js"></script></head>`) {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestCyclicLayoutsFailToCompile(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "layouts/a.blade.tpl", "@extends('layouts/b.blade.tpl')")
+	writeTempTemplate(t, tmp, "layouts/b.blade.tpl", "@extends('layouts/a.blade.tpl')")
+	c := NewCompilerWithOptions(tmp, "blade", nil)
+	_, err := c.CompileString("@extends('layouts/a.blade.tpl')", "pages/p.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), "layout chain deeper") {
+		t.Fatalf("expected layout cycle error, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"fmt"
+	"iter"
+	"reflect"
+	"sort"
+)
+
+// maxWhileIterations bounds @while loops whose condition never turns false.
+const maxWhileIterations = 100000
+
+// loopState holds the flattened keys and values of a @foreach collection
+// and builds the Blade $loop variable for each iteration.
+type loopState struct {
+	Keys   []interface{}
+	Values []interface{}
+	parent interface{}
+	depth  int
+}
+
+// loopOver prepares coll for a @foreach. Slices and arrays iterate in order
+// with their index as key; maps iterate in sorted key order, matching range.
+// parent is the enclosing $loop, or nil at the top level.
+func loopOver(coll interface{}, parent interface{}) (*loopState, error) {
+	s := &loopState{parent: parent, depth: 1}
+	if p, ok := parent.(map[string]interface{}); ok {
+		if d, ok := p["depth"].(int); ok {
+			s.depth = d + 1
+		}
+	}
+	v := reflect.ValueOf(coll)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return s, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return s, nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			s.Keys = append(s.Keys, i)
+			s.Values = append(s.Values, v.Index(i).Interface())
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return lessValue(keys[i], keys[j]) })
+		for _, k := range keys {
+			s.Keys = append(s.Keys, k.Interface())
+			s.Values = append(s.Values, v.MapIndex(k).Interface())
+		}
+	default:
+		return nil, fmt.Errorf("@foreach: cannot iterate over %s", v.Type())
+	}
+	return s, nil
+}
+
+// At returns the $loop variable for iteration i.
+func (s *loopState) At(i int) map[string]interface{} {
+	count := len(s.Values)
+	return map[string]interface{}{
+		"index":     i,
+		"iteration": i + 1,
+		"remaining": count - i - 1,
+		"count":     count,
+		"first":     i == 0,
+		"last":      i == count-1,
+		"depth":     s.depth,
+		"parent":    s.parent,
+	}
+}
+
+// lessValue orders map keys of the same kind.
+func lessValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	}
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
+
+// forRange yields the values of @for($i = start; $i op end; $i += step).
+func forRange(start interface{}, op string, end interface{}, step interface{}) (iter.Seq[int], error) {
+	from, err := toInt(start)
+	if err != nil {
+		return nil, fmt.Errorf("@for start: %w", err)
+	}
+	to, err := toInt(end)
+	if err != nil {
+		return nil, fmt.Errorf("@for bound: %w", err)
+	}
+	by, err := toInt(step)
+	if err != nil {
+		return nil, fmt.Errorf("@for step: %w", err)
+	}
+	if by == 0 {
+		return nil, fmt.Errorf("@for step must not be zero")
+	}
+	var cond func(i int) bool
+	switch op {
+	case "<":
+		cond = func(i int) bool { return i < to }
+	case "<=":
+		cond = func(i int) bool { return i <= to }
+	case ">":
+		cond = func(i int) bool { return i > to }
+	case ">=":
+		cond = func(i int) bool { return i >= to }
+	case "!=":
+		cond = func(i int) bool { return i != to && (by > 0) == (i < to) }
+	default:
+		return nil, fmt.Errorf("@for: unsupported comparison %q", op)
+	}
+	return func(yield func(int) bool) {
+		for i := from; cond(i); i += by {
+			if !yield(i) {
+				return
+			}
+		}
+	}, nil
+}
+
+// numRange returns the integers from start to end inclusive, like PHP's
+// range(). An optional step (default 1) sets the increment; the direction
+// follows start and end.
+func numRange(start, end interface{}, step ...interface{}) ([]int, error) {
+	from, err := toInt(start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toInt(end)
+	if err != nil {
+		return nil, err
+	}
+	by := 1
+	if len(step) > 0 {
+		if by, err = toInt(step[0]); err != nil {
+			return nil, err
+		}
+		if by < 0 {
+			by = -by
+		}
+		if by == 0 {
+			return nil, fmt.Errorf("numRange: step must not be zero")
+		}
+	}
+	var out []int
+	if from <= to {
+		for i := from; i <= to; i += by {
+			out = append(out, i)
+		}
+	} else {
+		for i := from; i >= to; i -= by {
+			out = append(out, i)
+		}
+	}
+	return out, nil
+}
+
+// whileLoop yields iteration numbers without end; @while breaks out of it.
+func whileLoop() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+// whileGuard fails the render once a @while loop exceeds maxWhileIterations.
+func whileGuard(i int) (string, error) {
+	if i >= maxWhileIterations {
+		return "", fmt.Errorf("@while exceeded %d iterations", maxWhileIterations)
+	}
+	return "", nil
+}
+
+// neg negates an integer, used for @for steps such as $i -= 2.
+func neg(v interface{}) (int, error) {
+	n, err := toInt(v)
+	return -n, err
+}
+
+// toInt converts a numeric template value to int.
+func toInt(v interface{}) (int, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int(rv.Float()), nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
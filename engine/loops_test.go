@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestForeachKeyValueOverMap(t *testing.T) {
+	src := `@foreach($prices as $name => $price){{ $name }}={{ $price }};@endforeach`
+	got := renderBlade(t, src, map[string]interface{}{
+		"prices": map[string]int{"pear": 3, "apple": 1},
+	})
+	if got != "apple=1;pear=3;" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestForeachLoopVariable(t *testing.T) {
+	src := `@foreach($items as $i => $item){{ $i }}:{{ $loop.iteration }}/{{ $loop.count }}@if($loop.first)[first]@endif@if($loop->last)[last]@endif[{{ $loop.remaining }}] @endforeach`
+	got := renderBlade(t, src, map[string]interface{}{"items": []string{"a", "b", "c"}})
+	want := "0:1/3[first][2] 1:2/3[1] 2:3/3[last][0] "
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestNestedForeachReachesOuterScope(t *testing.T) {
+	src := `@foreach($groups as $group)@foreach($group.Items as $item){{ $group.Name }}.{{ $item }}#{{ $loop.depth }}^{{ $loop.parent.index }} {{ $title }}|@endforeach@endforeach`
+	data := map[string]interface{}{
+		"title": "T",
+		"groups": []map[string]interface{}{
+			{"Name": "g1", "Items": []string{"x", "y"}},
+			{"Name": "g2", "Items": []string{"z"}},
+		},
+	}
+	got := renderBlade(t, src, data)
+	want := "g1.x#2^0 T|g1.y#2^0 T|g2.z#2^1 T|"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestForelseRendersEmptyBranch(t *testing.T) {
+	src := `<ul>@forelse($users as $user)<li>{{ $user }}</li>@empty<li>none</li>@endforelse</ul>`
+	if got := renderBlade(t, src, map[string]interface{}{"users": []string{}}); got != "<ul><li>none</li></ul>" {
+		t.Fatalf("empty: got %q", got)
+	}
+	if got := renderBlade(t, src, map[string]interface{}{}); got != "<ul><li>none</li></ul>" {
+		t.Fatalf("missing: got %q", got)
+	}
+	if got := renderBlade(t, src, map[string]interface{}{"users": []string{"ann"}}); got != "<ul><li>ann</li></ul>" {
+		t.Fatalf("non-empty: got %q", got)
+	}
+}
+
+func TestForeachRejectsMalformedHeader(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	_, err := c.CompileString(`@foreach($items)x @endforeach`, "bad.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), "invalid @foreach header") {
+		t.Fatalf("expected header error, got %v", err)
+	}
+}
+
+func TestForLoopWithBreakAndContinue(t *testing.T) {
+	src := `@for($i = 0; $i < $n; $i++)@continue(eq $i 1)@break(eq $i 4){{ $i }},@endfor`
+	if got := renderBlade(t, src, map[string]interface{}{"n": 10}); got != "0,2,3," {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestForLoopCountsDownWithStep(t *testing.T) {
+	src := `@for($i = 10; $i >= 0; $i -= 5){{ $i }} @endfor`
+	if got := renderBlade(t, src, nil); got != "10 5 0 " {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestWhileLoopStopsWhenConditionTurnsFalse(t *testing.T) {
+	src := `{{ $more := true }}@while($more)once{{ $more = false }}@endwhile`
+	if got := renderBlade(t, src, nil); got != "once" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+type countdown struct{ N int }
+
+func (c *countdown) Tick() string {
+	c.N--
+	return ""
+}
+
+func TestWhileConditionReadsPageData(t *testing.T) {
+	src := `@while($clock->N > 0){{ $clock->N }},{{ $clock->tick() }}@endwhile`
+	data := map[string]interface{}{"clock": &countdown{N: 3}}
+	if got := renderBlade(t, src, data); got != "3,2,1," {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestNumRangeHelper(t *testing.T) {
+	src := `@foreach(numRange 1 3 as $n){{ $n }}{{ if not $loop.last }}-{{ end }}@endforeach`
+	if got := renderBlade(t, src, nil); got != "1-2-3" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestBreakOutsideLoopIsRejected(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	_, err := c.CompileString(`@if($a) @break @endif`, "bad.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), "@break outside of a loop") {
+		t.Fatalf("expected @break outside loop error, got %v", err)
+	}
+}
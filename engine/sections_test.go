@@ -33,7 +33,7 @@ func TestSectionOverridesBlockAndDefinePrepend(t *testing.T) {
 	// create page that extends layout and defines sections
 	pagePath := filepath.Join(pagesDir, "home.blade.tpl")
 	pageContent := `@extends('layouts/base.blade.tpl')
-@section('title')My Page Title@endsection
+@section('title', 'My Page Title')
 @section('content')<p>Hello world</p>@endsection`
 	if err := os.WriteFile(pagePath, []byte(pageContent), 0644); err != nil {
 		t.Fatalf("write page: %v", err)
@@ -0,0 +1,296 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SourceLocation is a position in an original template file.
+type SourceLocation struct {
+	File string
+	Line int
+	Col  int
+}
+
+func (l SourceLocation) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Col)
+}
+
+// TemplateError is a compile or render error mapped back to the template
+// source the developer wrote, rather than the compiled Go template text.
+type TemplateError struct {
+	Template string         // template being compiled or rendered
+	Location SourceLocation // where the error originates (may be an include or layout)
+	Message  string
+	Err      error // underlying error, if any
+}
+
+func (e *TemplateError) Error() string {
+	msg := e.Location.String() + ": " + e.Message
+	if e.Template != "" && e.Template != e.Location.File {
+		msg += " (in " + e.Template + ")"
+	}
+	return msg
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// RenderError is an error executing a template. Err is usually a
+// *TemplateError pointing at the source; Key is the path of the missing
+// map key or unknown field, e.g. user.email, when that caused the error.
+type RenderError struct {
+	Template string
+	Location SourceLocation
+	Key      string
+	Err      error
+}
+
+func (e *RenderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// missingKeyRe matches execution errors about a missing map key or field,
+// capturing the expression being evaluated: at <.user.email>: map has no entry...
+var missingKeyRe = regexp.MustCompile(`at <([^>]+)>: (?:map has no entry for key|can't evaluate field)`)
+
+// generatedVarRe matches the data variables of component bodies.
+var generatedVarRe = regexp.MustCompile(`^\$__c\d+\.`)
+
+// newRenderError wraps an execution error, already mapped to the source,
+// of templateName.
+func newRenderError(templateName string, err error) *RenderError {
+	re := &RenderError{Template: templateName, Location: SourceLocation{File: templateName}, Err: err}
+	var terr *TemplateError
+	if errors.As(err, &terr) {
+		re.Location = terr.Location
+	}
+	if m := missingKeyRe.FindStringSubmatch(err.Error()); m != nil {
+		// data keys lose their template prefix, variables keep their $
+		key := generatedVarRe.ReplaceAllString(m[1], "")
+		key = strings.TrimPrefix(strings.TrimPrefix(key, "$."), ".")
+		re.Key = key
+	}
+	return re
+}
+
+// segment maps compiled[Start:End) back to a source location. Verbatim
+// segments were copied unchanged from the source, so a position inside them
+// is derived by counting lines and columns from the segment start.
+type segment struct {
+	Start    int    `json:"s"`
+	End      int    `json:"e"`
+	File     string `json:"f"`
+	Line     int    `json:"l"`
+	Col      int    `json:"c"`
+	Verbatim bool   `json:"v,omitempty"`
+}
+
+// mappedText is compiled template text together with its source map.
+type mappedText struct {
+	Text string    `json:"-"`
+	Segs []segment `json:"segments"`
+}
+
+// plainText wraps compiled text that has no source information.
+func plainText(s string) *mappedText {
+	return &mappedText{Text: s}
+}
+
+// verbatimText maps s one-to-one onto file starting at line 1, column 1.
+func verbatimText(s, file string) *mappedText {
+	m := &mappedText{Text: s}
+	if s != "" {
+		m.Segs = []segment{{Start: 0, End: len(s), File: file, Line: 1, Col: 1, Verbatim: true}}
+	}
+	return m
+}
+
+func (m *mappedText) String() string {
+	return m.Text
+}
+
+// advance moves loc forward over text copied verbatim from the source.
+func advance(line, col int, text string) (int, int) {
+	for _, r := range text {
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// slice returns m.Text[i:j] with the segments clipped to that range.
+func (m *mappedText) slice(i, j int) *mappedText {
+	out := &mappedText{Text: m.Text[i:j]}
+	for _, s := range m.Segs {
+		if s.End <= i || s.Start >= j {
+			continue
+		}
+		if s.Start < i {
+			if s.Verbatim {
+				s.Line, s.Col = advance(s.Line, s.Col, m.Text[s.Start:i])
+			}
+			s.Start = i
+		}
+		if s.End > j {
+			s.End = j
+		}
+		s.Start -= i
+		s.End -= i
+		out.Segs = append(out.Segs, s)
+	}
+	return out
+}
+
+// trimSpace trims leading and trailing whitespace, keeping the map aligned.
+func (m *mappedText) trimSpace() *mappedText {
+	start := len(m.Text) - len(strings.TrimLeft(m.Text, " \t\r\n"))
+	end := len(strings.TrimRight(m.Text, " \t\r\n"))
+	if end < start {
+		end = start
+	}
+	return m.slice(start, end)
+}
+
+// locate maps a byte offset in the compiled text to its source location.
+func (m *mappedText) locate(offset int) (SourceLocation, bool) {
+	i := sort.Search(len(m.Segs), func(i int) bool { return m.Segs[i].End > offset })
+	if i == len(m.Segs) || m.Segs[i].Start > offset {
+		return SourceLocation{}, false
+	}
+	s := m.Segs[i]
+	loc := SourceLocation{File: s.File, Line: s.Line, Col: s.Col}
+	if s.Verbatim {
+		loc.Line, loc.Col = advance(s.Line, s.Col, m.Text[s.Start:offset])
+	}
+	return loc, true
+}
+
+// locateLineCol maps a 1-based line and 0-based byte column of the compiled
+// text, as reported by text/template, to a source location. When col is
+// unknown (< 0) the first generated action on that line is used.
+func (m *mappedText) locateLineCol(line, col int) (SourceLocation, bool) {
+	start := 0
+	for l := 1; l < line; l++ {
+		nl := strings.IndexByte(m.Text[start:], '\n')
+		if nl < 0 {
+			return SourceLocation{}, false
+		}
+		start += nl + 1
+	}
+	if col >= 0 {
+		return m.locate(start + col)
+	}
+	end := len(m.Text)
+	if nl := strings.IndexByte(m.Text[start:], '\n'); nl >= 0 {
+		end = start + nl
+	}
+	for _, s := range m.Segs {
+		if !s.Verbatim && s.Start >= start && s.Start <= end {
+			return m.locate(s.Start)
+		}
+	}
+	return m.locate(start)
+}
+
+// mappedBuilder accumulates compiled text and its source map.
+type mappedBuilder struct {
+	sb   strings.Builder
+	segs []segment
+}
+
+func (b *mappedBuilder) Len() int { return b.sb.Len() }
+
+// write appends s generated from the given source location.
+func (b *mappedBuilder) write(s string, loc SourceLocation, verbatim bool) {
+	if s == "" {
+		return
+	}
+	start := b.sb.Len()
+	b.sb.WriteString(s)
+	if loc.File == "" {
+		return
+	}
+	b.segs = append(b.segs, segment{Start: start, End: b.sb.Len(), File: loc.File, Line: loc.Line, Col: loc.Col, Verbatim: verbatim})
+}
+
+// writeMapped appends already mapped text.
+func (b *mappedBuilder) writeMapped(m *mappedText) {
+	start := b.sb.Len()
+	b.sb.WriteString(m.Text)
+	for _, s := range m.Segs {
+		s.Start += start
+		s.End += start
+		b.segs = append(b.segs, s)
+	}
+}
+
+func (b *mappedBuilder) mapped() *mappedText {
+	return &mappedText{Text: b.sb.String(), Segs: append([]segment(nil), b.segs...)}
+}
+
+// concatMapped joins mapped fragments.
+func concatMapped(parts ...*mappedText) *mappedText {
+	var b mappedBuilder
+	for _, p := range parts {
+		b.writeMapped(p)
+	}
+	return b.mapped()
+}
+
+// replaceAllMapped is regexp.ReplaceAllStringFunc for mapped text; repl
+// receives the submatch indices of each match.
+func replaceAllMapped(re *regexp.Regexp, m *mappedText, repl func(sub []int) *mappedText) *mappedText {
+	var b mappedBuilder
+	last := 0
+	for _, sub := range re.FindAllStringSubmatchIndex(m.Text, -1) {
+		b.writeMapped(m.slice(last, sub[0]))
+		b.writeMapped(repl(sub))
+		last = sub[1]
+	}
+	b.writeMapped(m.slice(last, len(m.Text)))
+	return b.mapped()
+}
+
+// templateErrRe matches the location prefix of text/template and
+// html/template errors: "template: name:12:7: msg" or "html/template:name:12: msg".
+// Names of included views contain a colon ("include:components/card.blade.tpl").
+var templateErrRe = regexp.MustCompile(`(?s)(?:html/)?template: ?(\S+?):(\d+)(?::(\d+))?: (.*)$`)
+
+// mapTemplateError rewrites an error reported against compiled text parsed
+// under parseName into a *TemplateError pointing at the original source.
+// Errors in included views and fragments defined in the same text are
+// mapped as well.
+// Errors that carry no position in that text are returned unchanged.
+func mapTemplateError(m *mappedText, parseName, templateName string, err error) error {
+	if err == nil || m == nil {
+		return err
+	}
+	sub := templateErrRe.FindStringSubmatch(err.Error())
+	if sub == nil || (sub[1] != parseName && !strings.HasPrefix(sub[1], includePrefix) && !strings.HasPrefix(sub[1], fragmentPrefix)) {
+		return err
+	}
+	line, _ := strconv.Atoi(sub[2])
+	col := -1
+	if sub[3] != "" {
+		col, _ = strconv.Atoi(sub[3])
+	}
+	loc, ok := m.locateLineCol(line, col)
+	if !ok {
+		return err
+	}
+	return &TemplateError{Template: templateName, Location: loc, Message: sub[4], Err: err}
+}
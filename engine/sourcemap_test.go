@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type sourceMapUser struct {
+	Name string
+}
+
+func TestCompileErrorPointsAtIncludedFile(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "components/broken.blade.tpl", "<div>\n  ok\n  {{ (.Name }}\n</div>")
+	writeTempTemplate(t, tmp, "pages/home.blade.tpl", "<main>\n@include('components/broken.blade.tpl')\n</main>")
+
+	c := NewCompilerWithOptions(tmp, "blade", nil)
+	_, err := c.Compile(filepath.Join(tmp, "pages/home.blade.tpl"))
+	var terr *TemplateError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected *TemplateError, got %v", err)
+	}
+	if terr.Location.File != "components/broken.blade.tpl" || terr.Location.Line != 3 {
+		t.Fatalf("expected error at components/broken.blade.tpl:3, got %s", terr.Location)
+	}
+}
+
+func TestParseErrorReportsBladeLine(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "pages/open.blade.tpl", "<p>\n\n    @foreach($items as $item)\n</p>")
+
+	c := NewCompilerWithOptions(tmp, "blade", nil)
+	_, err := c.Compile(filepath.Join(tmp, "pages/open.blade.tpl"))
+	if err == nil || !strings.Contains(err.Error(), "pages/open.blade.tpl:3:5") {
+		t.Fatalf("expected error at pages/open.blade.tpl:3:5, got %v", err)
+	}
+}
+
+func TestExecutionErrorInSectionMapsThroughLayout(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "layouts/base.blade.tpl", "<html>\n<body>\n@yield('content')\n</body>\n</html>")
+	writeTempTemplate(t, tmp, "pages/profile.blade.tpl", "@extends('layouts/base.blade.tpl')\n\n@section('content')\n<h1>{{ $user.Name }}</h1>\n<p>{{ $user.Nmae }}</p>\n@endsection")
+
+	be := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, Development: true})
+	_, err := be.RenderString("pages/profile.blade.tpl", map[string]interface{}{"user": sourceMapUser{Name: "Ann"}})
+	var terr *TemplateError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected *TemplateError, got %v", err)
+	}
+	if terr.Location.File != "pages/profile.blade.tpl" || terr.Location.Line != 5 {
+		t.Fatalf("expected error at pages/profile.blade.tpl:5, got %s (%v)", terr.Location, err)
+	}
+	if !strings.Contains(terr.Message, "Nmae") {
+		t.Fatalf("expected message to name the bad field, got %q", terr.Message)
+	}
+}
+
+func TestMappedTextSliceKeepsVerbatimPositions(t *testing.T) {
+	m := verbatimText("ab\ncd\nef", "x.tpl")
+	loc, ok := m.slice(4, 8).locate(2)
+	if !ok || loc.Line != 3 || loc.Col != 1 {
+		t.Fatalf("expected x.tpl:3:1, got %v (ok=%v)", loc, ok)
+	}
+}
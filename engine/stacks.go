@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+)
+
+// stacksTemplate is defined in compiled templates that use @push or @stack;
+// their output is buffered, up to each flush point when streamed, so
+// pushed content can be moved into its stack.
+const stacksTemplate = "blade:stacks"
+
+// stackMarkRe matches the markers written by stackMark:
+// <!--blade:push NAME ID-->, <!--blade:prepend NAME ID-->, <!--blade:end-->
+// and <!--blade:stack NAME-->.
+var stackMarkRe = regexp.MustCompile(`<!--blade:(push|prepend|end|stack)(?: ([\w.:/-]+?))?(?: ([\w.:/-]+?))?-->`)
+
+// stackMark writes a marker for @push, @prepend, their end and @stack. The
+// markers are resolved by resolveStacks once the whole page has rendered, so
+// content pushed from includes, components and loops lands in render order.
+func stackMark(kind, name, id string) template.HTML {
+	s := "<!--blade:" + kind
+	if name != "" {
+		s += " " + name
+		if id != "" {
+			s += " " + id
+		}
+	}
+	return template.HTML(s + "-->")
+}
+
+// resolveStacks removes pushed content from out and inserts it at the @stack
+// markers: prepends first, the most recent one leading, then pushes in render
+// order. Pushes with an id (@pushOnce) are kept once per stack.
+func resolveStacks(out []byte) []byte {
+	return newStackResolver().resolve(out)
+}
+
+// stackResolver resolves the stacks of a render. A streamed render passes
+// its output a part at a time, up to each flush point: pushes carry over to
+// the stacks of later parts, and content pushed to a stack that an earlier
+// part already wrote is dropped and reported in err.
+type stackResolver struct {
+	pushes   map[string][][]byte
+	prepends map[string][][]byte
+	seen     map[string]bool // @pushOnce ids already kept
+	sent     map[string]bool // stacks of the parts resolved so far
+	err      error
+}
+
+func newStackResolver() *stackResolver {
+	return &stackResolver{
+		pushes:   map[string][][]byte{},
+		prepends: map[string][][]byte{},
+		seen:     map[string]bool{},
+		sent:     map[string]bool{},
+	}
+}
+
+// resolve returns the next part of the output with its stacks filled in.
+func (r *stackResolver) resolve(out []byte) []byte {
+	marks := stackMarkRe.FindAllSubmatchIndex(out, -1)
+	if len(marks) == 0 {
+		return out
+	}
+	type stackPos struct {
+		name string
+		at   int // offset in body
+	}
+	var (
+		body   []byte
+		stacks []stackPos
+		last   = 0
+	)
+	for i := 0; i < len(marks); i++ {
+		m := marks[i]
+		kind := string(out[m[2]:m[3]])
+		switch kind {
+		case "stack":
+			body = append(body, out[last:m[0]]...)
+			stacks = append(stacks, stackPos{name: string(out[m[4]:m[5]]), at: len(body)})
+			last = m[1]
+		case "push", "prepend":
+			if i+1 >= len(marks) || string(out[marks[i+1][2]:marks[i+1][3]]) != "end" {
+				continue // unbalanced marker, leave it in place
+			}
+			end := marks[i+1]
+			name := string(out[m[4]:m[5]])
+			content := out[m[1]:end[0]]
+			body = append(body, out[last:m[0]]...)
+			last = end[1]
+			i++
+			if m[6] >= 0 {
+				key := name + " " + string(out[m[6]:m[7]])
+				if r.seen[key] {
+					continue
+				}
+				r.seen[key] = true
+			}
+			if r.sent[name] {
+				if r.err == nil {
+					r.err = fmt.Errorf("content pushed to stack %q after the stack was flushed; push it before the @flush", name)
+				}
+				continue
+			}
+			if kind == "push" {
+				r.pushes[name] = append(r.pushes[name], content)
+			} else {
+				r.prepends[name] = append(r.prepends[name], content)
+			}
+		}
+	}
+	body = append(body, out[last:]...)
+
+	var res bytes.Buffer
+	prev := 0
+	for _, s := range stacks {
+		res.Write(body[prev:s.at])
+		for i := len(r.prepends[s.name]) - 1; i >= 0; i-- {
+			res.Write(r.prepends[s.name][i])
+		}
+		for _, p := range r.pushes[s.name] {
+			res.Write(p)
+		}
+		prev = s.at
+		r.sent[s.name] = true
+	}
+	res.Write(body[prev:])
+	return res.Bytes()
+}
+
+// openPush reports whether out ends inside a @push or @prepend, whose
+// content is not complete yet.
+func openPush(out []byte) bool {
+	open := false
+	for _, m := range stackMarkRe.FindAllSubmatch(out, -1) {
+		switch string(m[1]) {
+		case "push", "prepend":
+			open = true
+		case "end":
+			open = false
+		}
+	}
+	return open
+}
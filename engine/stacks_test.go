@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPushFromPageIncludesAndComponentsInRenderOrder(t *testing.T) {
+	files := map[string]string{
+		"layouts/base.blade.tpl":     `<head>@stack('styles')</head><body>@yield('content')@stack('scripts')</body>`,
+		"components/chart.blade.tpl": `<canvas></canvas>@pushOnce('scripts')<script src="chart.js"></script>@endPushOnce`,
+		"partials/row.blade.tpl":     `<tr>{{ $n }}</tr>@push('scripts')<script data-row="{{ $n }}"></script>@endpush`,
+		"pages/p.blade.tpl": `@extends('layouts/base.blade.tpl')
+@section('content')
+@push('styles')<link href="page.css">@endpush
+@foreach($rows as $r)@include('partials/row', ['n' => $r])@endforeach
+<x-chart /><x-chart />
+@prepend('scripts')<script src="jquery.js"></script>@endprepend
+@push('scripts', '<script src="last.js"></script>')
+@endsection`,
+	}
+	out := renderPage(t, files, "pages/p.blade.tpl", map[string]interface{}{"rows": []int{1, 2}})
+	if !strings.Contains(out, `<head><link href="page.css"></head>`) {
+		t.Fatalf("styles not pushed into head:\n%s", out)
+	}
+	want := `<script src="jquery.js"></script><script data-row="1"></script><script data-row="2"></script><script src="chart.js"></script><script src="last.js"></script></body>`
+	if !strings.Contains(out, want) {
+		t.Fatalf("expected scripts %q in output:\n%s", want, out)
+	}
+	if strings.Count(out, "chart.js") != 1 || strings.Contains(out, "<!--blade:") {
+		t.Fatalf("expected pushOnce content once and no markers:\n%s", out)
+	}
+}
+
+func TestResolveStacksPrependOrderAndOnceIDs(t *testing.T) {
+	in := `<!--blade:stack js-->|<!--blade:prepend js-->a<!--blade:end--><!--blade:prepend js-->b<!--blade:end-->` +
+		`<!--blade:push js x-->c<!--blade:end--><!--blade:push js x-->c<!--blade:end-->`
+	if got := string(resolveStacks([]byte(in))); got != "bac|" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestPushRequiresValidStackName(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	_, err := c.CompileString(`@push('my scripts')x @endpush`, "bad.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), "invalid stack name") {
+		t.Fatalf("expected invalid stack name error, got %v", err)
+	}
+}
+
+func TestInlinePushKeepsBracesAsText(t *testing.T) {
+	files := map[string]string{
+		"layouts/base.blade.tpl": `<body>@yield('content')@stack('scripts')</body>`,
+		"pages/p.blade.tpl":      "@extends('layouts/base.blade.tpl')\n@section('content')@push('scripts', '<script>var t = {{ x }};</script>')@endsection",
+	}
+	out := renderPage(t, files, "pages/p.blade.tpl", nil)
+	if !strings.Contains(out, "<script>var t = {{ x }};</script></body>") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
+
+func TestStackInsideATagIsRejected(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	for _, src := range []string{`<body class="@stack('classes')">`, `<div {{ if .a }}x{{ end }} @stack('attrs')>`} {
+		_, err := c.CompileString(src, "bad.blade.tpl")
+		if err == nil || !strings.Contains(err.Error(), "cannot be used inside an HTML tag") {
+			t.Errorf("%s: expected an error for @stack inside a tag, got %v", src, err)
+		}
+	}
+	if _, err := c.CompileString(`<p title="a>b">x</p>@stack('scripts')`, "ok.blade.tpl"); err != nil {
+		t.Fatalf("unexpected error after a closed tag: %v", err)
+	}
+}
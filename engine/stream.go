@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+)
+
+// flushTemplate is defined in compiled templates that use @flush; their
+// output passes through a flushWriter, which removes the markers.
+const flushTemplate = "blade:flush"
+
+// flushMarker is written by @flush where streamed output is flushed.
+const flushMarker = "<!--blade:flush-->"
+
+// flushMark writes the @flush marker.
+func flushMark() template.HTML {
+	return flushMarker
+}
+
+// flushWriter passes rendered output on without the @flush markers. With
+// a flush func it also flushes the output at each marker and after the
+// first </head>, so the browser can fetch styles and scripts while the
+// rest of the page renders. html/template writes each action's output in
+// one call, so a marker never spans two writes.
+//
+// When a streamed template uses @push or @stack, output is held until the
+// next flush point and written with its stacks resolved from the content
+// pushed so far. The flush after </head> is skipped when the head holds a
+// @stack, since the page usually pushes to it later; the head then goes out
+// at the first @flush.
+type flushWriter struct {
+	w       io.Writer
+	flush   func() error
+	head    bool           // </head> was written
+	stacks  *stackResolver // set for streamed templates using stacks
+	pending []byte         // output held for stacks
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for {
+		i := bytes.Index(p, []byte(flushMarker))
+		if i < 0 {
+			break
+		}
+		if err := f.emit(p[:i]); err != nil {
+			return 0, err
+		}
+		if err := f.flushPoint(false); err != nil {
+			return 0, err
+		}
+		p = p[i+len(flushMarker):]
+	}
+	if i := bytes.Index(p, []byte("</head>")); i >= 0 && !f.head {
+		f.head = true
+		i += len("</head>")
+		if err := f.emit(p[:i]); err != nil {
+			return 0, err
+		}
+		if err := f.flushPoint(true); err != nil {
+			return 0, err
+		}
+		p = p[i:]
+	}
+	if err := f.emit(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// emit writes p, or holds it when stacks are resolved.
+func (f *flushWriter) emit(p []byte) error {
+	if f.stacks != nil {
+		f.pending = append(f.pending, p...)
+		return nil
+	}
+	_, err := f.w.Write(p)
+	return err
+}
+
+// flushPoint writes the held output and flushes. head marks the flush
+// after </head>.
+func (f *flushWriter) flushPoint(head bool) error {
+	if f.stacks != nil {
+		if head && bytes.Contains(f.pending, []byte("<!--blade:stack ")) || openPush(f.pending) {
+			return nil
+		}
+		if err := f.finish(); err != nil {
+			return err
+		}
+	}
+	return f.doFlush()
+}
+
+// finish writes the held output with its stacks resolved. It reports
+// content pushed to a stack that was already flushed, which is dropped.
+func (f *flushWriter) finish() error {
+	if f.stacks == nil {
+		return nil
+	}
+	out := f.stacks.resolve(f.pending)
+	f.pending = nil
+	if _, err := f.w.Write(out); err != nil {
+		return err
+	}
+	return f.stacks.err
+}
+
+func (f *flushWriter) doFlush() error {
+	if f.flush == nil {
+		return nil
+	}
+	return f.flush()
+}
+
+// RenderStream renders a template to w, calling flush at each @flush and
+// after the layout's </head> so the start of a large page reaches the
+// client early. Compile errors are returned before anything is written.
+// With @push and @stack, each flush writes its stacks with the content
+// pushed before it, and pushing to a stack that was already flushed is an
+// error; a head holding a @stack waits for the first @flush.
+func (b *BladeEngine) RenderStream(w io.Writer, templateName string, data interface{}, flush func() error) error {
+	tmpl, err := b.load(templateName)
+	if err != nil {
+		return err
+	}
+	return b.execute(tmpl, &flushWriter{w: w, flush: flush}, templateName, "", data)
+}
+
+// RenderHTTP streams a template to a net/http response like RenderStream,
+// flushing through http.Flusher when w supports it.
+func (b *BladeEngine) RenderHTTP(w http.ResponseWriter, templateName string, data interface{}) error {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	rc := http.NewResponseController(w)
+	return b.RenderStream(w, templateName, data, func() error {
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var streamFiles = map[string]string{
+	"layouts/app.blade.tpl": `<html><head><title>@yield('title')</title></head>
+<body>@yield('content')</body></html>`,
+	"pages/report.blade.tpl": `@extends('layouts/app.blade.tpl')
+@section('title', 'Report')
+@section('content')
+<h1>{{ $title }}</h1>
+@flush
+@foreach($rows as $row)<p>{{ $row }}</p>@endforeach
+<i>{{ ._fiber.Header "X-Who" }}</i>
+@endsection`,
+}
+
+var streamData = map[string]interface{}{"title": "Q3", "rows": []string{"a", "b"}}
+
+func TestRenderStreamFlushesAfterHeadAndAtFlush(t *testing.T) {
+	var buf bytes.Buffer
+	var flushed []string
+	err := newEngine(t, streamFiles, cachedConfig).RenderStream(&buf, "pages/report.blade.tpl", streamData, func() error {
+		flushed = append(flushed, buf.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if len(flushed) != 2 {
+		t.Fatalf("expected 2 flushes, got %d: %q", len(flushed), flushed)
+	}
+	if !strings.HasSuffix(flushed[0], "</head>") {
+		t.Errorf("expected the first flush after </head>, got %q", flushed[0])
+	}
+	if !strings.Contains(flushed[1], "<h1>Q3</h1>") || strings.Contains(flushed[1], "<p>") {
+		t.Errorf("expected the second flush at @flush, got %q", flushed[1])
+	}
+	if out := buf.String(); strings.Contains(out, "blade:flush") || !strings.Contains(out, "<p>b</p>") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestRenderRemovesFlushMarkers(t *testing.T) {
+	out, err := newEngine(t, streamFiles, cachedConfig).RenderString("pages/report.blade.tpl", streamData)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if strings.Contains(out, "blade:flush") || !strings.Contains(out, "<h1>Q3</h1>\n\n<p>a</p>") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	out = renderPage(t, map[string]string{"pages/p.blade.tpl": `<head>@stack('css')</head>@flush<body>@push('css')<link>@endpush</body>`}, "pages/p.blade.tpl", nil)
+	if out != `<head><link></head><body></body>` {
+		t.Errorf("expected stacks resolved and markers removed, got %q", out)
+	}
+}
+
+func TestRenderStreamWithStacks(t *testing.T) {
+	files := map[string]string{
+		"layouts/app.blade.tpl":   `<html><head>@stack('styles')</head><body>@yield('content')@stack('scripts')</body></html>`,
+		"layouts/plain.blade.tpl": `<html><head><title>t</title></head><body>@yield('content')@stack('scripts')</body></html>`,
+		"pages/report.blade.tpl": `@extends('layouts/app.blade.tpl')
+@section('content')@push('styles')<link href="r.css">@endpush<h1>Q3</h1>@flush
+@foreach($rows as $row)<p>{{ $row }}</p>@push('scripts')<script data-row="{{ $row }}"></script>@endpush@endforeach
+@endsection`,
+		"pages/plain.blade.tpl": `@extends('layouts/plain.blade.tpl')
+@section('content')<h1>Q3</h1>@push('scripts')<script src="p.js"></script>@endpush@endsection`,
+		"pages/late.blade.tpl": `@extends('layouts/app.blade.tpl')
+@section('content')<h1>Q3</h1>@flush@push('styles')<link href="late.css">@endpush@endsection`,
+	}
+	be := newEngine(t, files, BladeConfig{Development: true})
+	render := func(page string) ([]string, string, error) {
+		var buf bytes.Buffer
+		var flushed []string
+		err := be.RenderStream(&buf, page, streamData, func() error {
+			flushed = append(flushed, buf.String())
+			return nil
+		})
+		return flushed, buf.String(), err
+	}
+
+	flushed, out, err := render("pages/report.blade.tpl")
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if len(flushed) != 1 || flushed[0] != `<html><head><link href="r.css"></head><body><h1>Q3</h1>` {
+		t.Errorf("expected one flush at @flush with the styles stack resolved, got %q", flushed)
+	}
+	if want := `<p>b</p><script data-row="a"></script><script data-row="b"></script></body></html>`; !strings.HasSuffix(strings.ReplaceAll(out, "\n", ""), want) || strings.Contains(out, "<!--blade:") {
+		t.Errorf("expected the scripts stack resolved at the end, got:\n%s", out)
+	}
+
+	flushed, out, err = render("pages/plain.blade.tpl")
+	if err != nil || len(flushed) != 1 || !strings.HasSuffix(flushed[0], "</head>") || !strings.Contains(out, `<script src="p.js"></script></body>`) {
+		t.Errorf("expected a flush after a head without stacks, got %v, %q:\n%s", err, flushed, out)
+	}
+
+	_, out, err = render("pages/late.blade.tpl")
+	if err == nil || !strings.Contains(err.Error(), `stack "styles" after the stack was flushed`) || strings.Contains(out, "late.css") {
+		t.Errorf("expected an error for a push after its stack was flushed, got %v:\n%s", err, out)
+	}
+	if out, err := be.RenderString("pages/late.blade.tpl", nil); err != nil || !strings.Contains(out, `<head><link href="late.css"></head>`) {
+		t.Errorf("expected Render to resolve the late push, got %v:\n%s", err, out)
+	}
+}
+
+func TestRenderHTTPFlushes(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if err := newEngine(t, streamFiles, cachedConfig).RenderHTTP(rec, "pages/report.blade.tpl", streamData); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !rec.Flushed || rec.Header().Get("Content-Type") != "text/html; charset=utf-8" || !strings.Contains(rec.Body.String(), "<p>a</p>") {
+		t.Errorf("unexpected response: flushed=%v headers=%v\n%s", rec.Flushed, rec.Header(), rec.Body.String())
+	}
+}
+
+func TestStreamWithCtx(t *testing.T) {
+	adapter := &FiberViewsAdapter{Engine: newEngine(t, streamFiles, cachedConfig)}
+	app := fiber.New()
+	app.Get("/report", func(c *fiber.Ctx) error {
+		return adapter.StreamWithCtx(c, "pages/report.blade.tpl", streamData)
+	})
+	app.Get("/missing", func(c *fiber.Ctx) error {
+		return adapter.StreamWithCtx(c, "pages/missing.blade.tpl", nil)
+	})
+
+	req := httptest.NewRequest("GET", "/report", nil)
+	req.Header.Set("X-Who", "tester")
+	resp, err := app.Test(req, 5000)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{"<title>Report</title>", "<p>b</p>", "<i>tester</i>"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %s in body:\n%s", want, body)
+		}
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/missing", nil), 5000)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("expected a 500 for a missing template, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var strictConfig = BladeConfig{Development: true, Strict: true}
+
+func TestStrictModeMissingKeys(t *testing.T) {
+	be := newEngine(t, map[string]string{
+		"components/card.blade.tpl": `@props(['title', 'footer'])<div {{ $attributes }}>{{ $title }}{{ $slot }}@if($footer)!@endif</div>`,
+		"pages/home.blade.tpl": `@props(['user', 'items'])
+<h1>{{ $user->name }} {{ $user->nick ?? 'anon' }}</h1>
+@foreach($items as $item){{ $loop->iteration }}{{ $item }}@endforeach
+<x-card title="T" class="c" />`,
+	}, strictConfig)
+	data := map[string]interface{}{"user": map[string]interface{}{"name": "Ann"}, "items": []string{"a"}}
+	out, err := be.RenderString("pages/home.blade.tpl", data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for _, want := range []string{"<h1>Ann anon</h1>", "1a", `<div class="c">T</div>`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+
+	_, err = be.RenderString("pages/home.blade.tpl", map[string]interface{}{"user": map[string]interface{}{}, "items": nil})
+	var rerr *RenderError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a *RenderError, got %v", err)
+	}
+	if rerr.Template != "pages/home.blade.tpl" || rerr.Location.Line != 2 || rerr.Key != "user.name" {
+		t.Errorf("got template %q, line %d, key %q", rerr.Template, rerr.Location.Line, rerr.Key)
+	}
+	var terr *TemplateError
+	if !errors.As(err, &terr) {
+		t.Errorf("RenderError should wrap the *TemplateError: %v", err)
+	}
+}
+
+func TestStrictModeRejectsUndeclaredVariables(t *testing.T) {
+	be := newEngine(t, map[string]string{
+		"pages/typo.blade.tpl": "@props(['user'])\n<p>{{ $usr['name'] }}</p>",
+		"pages/loop.blade.tpl": "{{ $loop->index }}",
+	}, strictConfig)
+	_, err := be.RenderString("pages/typo.blade.tpl", map[string]interface{}{"user": nil})
+	if err == nil || !strings.Contains(err.Error(), "pages/typo.blade.tpl:2:4: undeclared variable $usr") {
+		t.Fatalf("expected an undeclared variable error, got %v", err)
+	}
+	_, err = be.RenderString("pages/loop.blade.tpl", nil)
+	if err == nil || !strings.Contains(err.Error(), "undeclared variable $loop") {
+		t.Fatalf("expected $loop outside a loop to be rejected, got %v", err)
+	}
+}
+
+func TestLenientModeRendersMissingValuesEmpty(t *testing.T) {
+	files := map[string]string{
+		"pages/home.blade.tpl": `[{{ $missing }}][{!! $missing !!}][<a title="{{ $missing->x }}">][{{ .missing }}][{{ $missing ?? 'd' }}]`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{})
+	if want := `[][][<a title="">][][d]`; out != want {
+		t.Fatalf("got  %s\nwant %s", out, want)
+	}
+}
+
+func TestSetStrictKeepsCompiledCacheWhenUnchanged(t *testing.T) {
+	c := NewCompilerWithOptions(t.TempDir(), "blade", nil)
+	c.SetStrict(false)
+	if !c.lastExtended().IsZero() {
+		t.Fatal("setting the default mode should not outdate compiled files")
+	}
+	c.SetStrict(true)
+	changed := c.lastExtended()
+	if changed.IsZero() {
+		t.Fatal("turning strict mode on should outdate compiled files")
+	}
+	c.SetStrict(true)
+	if !c.lastExtended().Equal(changed) {
+		t.Fatal("setting the same mode again should not outdate compiled files")
+	}
+}
@@ -0,0 +1,500 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// CheckTemplate compiles templateName and checks it against dataType, the
+// type of the data later passed to Render: every field and method access
+// must exist on the Go type it is applied to, and every function and
+// method must be called with the right number of arguments. Values whose
+// type is only known at run time (interfaces, map[string]interface{}) are
+// not checked. Problems are returned together, each as a *TemplateError
+// pointing at the template source.
+func (b *BladeEngine) CheckTemplate(templateName string, dataType reflect.Type) error {
+	templatePath := filepath.Join(b.templatesDir, templateName)
+	comp := b.chooseCompilerFor(templateName)
+	tmpl, err := comp.ParseTemplate(templatePath)
+	if err != nil {
+		return err
+	}
+	comp.mapsMu.RLock()
+	src := comp.sourceMaps[templatePath]
+	comp.mapsMu.RUnlock()
+	tc := &typeChecker{
+		name:    templateName,
+		tmpl:    tmpl,
+		src:     src,
+		funcs:   comp.funcs(),
+		visited: map[string]bool{},
+		loops:   map[reflect.Type]bool{},
+	}
+	tc.check(tmpl, dataType)
+	return errors.Join(tc.errs...)
+}
+
+// ValidateAllTemplatesAgainst runs CheckTemplate for each template name in
+// samples, using the type of its sample data: a value such as User{} or
+// (*User)(nil), or a reflect.Type. The errors of all templates are joined.
+func (b *BladeEngine) ValidateAllTemplatesAgainst(samples map[string]interface{}) error {
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		t, ok := samples[name].(reflect.Type)
+		if !ok {
+			t = reflect.TypeOf(samples[name])
+		}
+		if err := b.CheckTemplate(name, t); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	boolType   = reflect.TypeOf(true)
+	intType    = reflect.TypeOf(0)
+	floatType  = reflect.TypeOf(0.0)
+	stringType = reflect.TypeOf("")
+	anyType    = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// builtinArity gives the minimum and maximum (-1 for any) number of
+// arguments of the html/template builtins, which are not in the FuncMap.
+var builtinArity = map[string][2]int{
+	"and": {1, -1}, "or": {1, -1}, "not": {1, 1}, "len": {1, 1},
+	"index": {1, -1}, "slice": {1, 4}, "call": {1, -1},
+	"print": {0, -1}, "printf": {1, -1}, "println": {0, -1},
+	"html": {0, -1}, "js": {0, -1}, "urlquery": {0, -1},
+	"eq": {2, -1}, "ne": {2, 2}, "lt": {2, 2}, "le": {2, 2}, "gt": {2, 2}, "ge": {2, 2},
+}
+
+// typeChecker walks a parsed template tracking the static type of dot and
+// of each variable. A nil type is unknown and stops checking.
+type typeChecker struct {
+	name    string // template name, for errors
+	tmpl    *template.Template
+	tree    *parse.Tree
+	src     *mappedText // source map of the compiled text, if known
+	funcs   template.FuncMap
+	vars    []checkVar
+	visited map[string]bool       // template name and dot type already checked
+	loops   map[reflect.Type]bool // struct types standing for loopOver results
+	errs    []error
+}
+
+type checkVar struct {
+	name string
+	typ  reflect.Type
+}
+
+// known reports whether t can be checked. Interfaces are resolved at run
+// time, so values of interface type are not.
+func known(t reflect.Type) bool {
+	return t != nil && t.Kind() != reflect.Interface
+}
+
+func (c *typeChecker) check(tmpl *template.Template, dot reflect.Type) {
+	c.tree = tmpl.Tree
+	c.vars = []checkVar{{"$", dot}}
+	c.visited[tmpl.Name()+"\x00"+fmt.Sprint(dot)] = true
+	c.walk(tmpl.Tree.Root, dot)
+}
+
+func (c *typeChecker) errorf(n parse.Node, format string, args ...interface{}) {
+	loc, ok := SourceLocation{}, false
+	if c.src != nil {
+		loc, ok = c.src.locate(int(n.Position()))
+	}
+	if !ok {
+		// "name:line:col" in the compiled text
+		where, _ := c.tree.ErrorContext(n)
+		parts := strings.Split(where, ":")
+		loc.File = c.name
+		if len(parts) >= 2 {
+			loc.Line, _ = strconv.Atoi(parts[len(parts)-2])
+			loc.Col, _ = strconv.Atoi(parts[len(parts)-1])
+		}
+	}
+	c.errs = append(c.errs, &TemplateError{Template: c.name, Location: loc, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *typeChecker) walk(node parse.Node, dot reflect.Type) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, item := range n.Nodes {
+			c.walk(item, dot)
+		}
+	case *parse.ActionNode:
+		c.declare(n.Pipe, c.pipe(n.Pipe, dot))
+	case *parse.IfNode:
+		c.branch(&n.BranchNode, dot, false)
+	case *parse.WithNode:
+		c.branch(&n.BranchNode, dot, true)
+	case *parse.RangeNode:
+		c.rangeNode(n, dot)
+	case *parse.TemplateNode:
+		c.templateCall(n, dot)
+	}
+}
+
+// declare gives the variables declared or assigned by p the type t.
+func (c *typeChecker) declare(p *parse.PipeNode, t reflect.Type) {
+	for _, v := range p.Decl {
+		if p.IsAssign {
+			for i := len(c.vars) - 1; i >= 0; i-- {
+				if c.vars[i].name == v.Ident[0] {
+					if c.vars[i].typ != t {
+						c.vars[i].typ = nil
+					}
+					break
+				}
+			}
+			continue
+		}
+		c.vars = append(c.vars, checkVar{v.Ident[0], t})
+	}
+}
+
+func (c *typeChecker) branch(n *parse.BranchNode, dot reflect.Type, with bool) {
+	mark := len(c.vars)
+	t := c.pipe(n.Pipe, dot)
+	c.declare(n.Pipe, t)
+	inner := dot
+	if with {
+		inner = t
+	}
+	c.walk(n.List, inner)
+	c.vars = c.vars[:mark]
+	c.walk(n.ElseList, dot)
+	c.vars = c.vars[:mark]
+}
+
+func (c *typeChecker) rangeNode(n *parse.RangeNode, dot reflect.Type) {
+	mark := len(c.vars)
+	key, elem := c.rangeTypes(n, c.pipe(n.Pipe, dot))
+	switch len(n.Pipe.Decl) {
+	case 1:
+		c.vars = append(c.vars, checkVar{n.Pipe.Decl[0].Ident[0], elem})
+	case 2:
+		c.vars = append(c.vars, checkVar{n.Pipe.Decl[0].Ident[0], key}, checkVar{n.Pipe.Decl[1].Ident[0], elem})
+	}
+	c.walk(n.List, elem)
+	c.vars = c.vars[:mark]
+	c.walk(n.ElseList, dot)
+	c.vars = c.vars[:mark]
+}
+
+// rangeTypes returns the key and element types of ranging over t.
+func (c *typeChecker) rangeTypes(n parse.Node, t reflect.Type) (key, elem reflect.Type) {
+	if !known(t) {
+		return nil, nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return intType, t.Elem()
+	case reflect.Map:
+		return t.Key(), t.Elem()
+	case reflect.Chan:
+		return t.Elem(), t.Elem()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return t, t
+	case reflect.Func:
+		return nil, nil
+	}
+	c.errorf(n, "range can't iterate over %s", t)
+	return nil, nil
+}
+
+// templateCall checks the template invoked by {{template "name" pipe}}
+// with dot set to the type of pipe, once per name and type.
+func (c *typeChecker) templateCall(n *parse.TemplateNode, dot reflect.Type) {
+	var t reflect.Type
+	if n.Pipe != nil {
+		t = c.pipe(n.Pipe, dot)
+	}
+	sub := c.tmpl.Lookup(n.Name)
+	if sub == nil || sub.Tree == nil {
+		c.errorf(n, "no such template %q", n.Name)
+		return
+	}
+	key := n.Name + "\x00" + fmt.Sprint(t)
+	if c.visited[key] {
+		return
+	}
+	c.visited[key] = true
+	tree, vars := c.tree, c.vars
+	c.tree, c.vars = sub.Tree, []checkVar{{"$", t}}
+	c.walk(sub.Tree.Root, t)
+	c.tree, c.vars = tree, vars
+}
+
+// pipe returns the type of a pipeline; each command after the first
+// receives the previous result as its last argument.
+func (c *typeChecker) pipe(p *parse.PipeNode, dot reflect.Type) reflect.Type {
+	if p == nil {
+		return nil
+	}
+	var t reflect.Type
+	for i, cmd := range p.Cmds {
+		t = c.command(cmd, dot, t, i > 0)
+	}
+	return t
+}
+
+func (c *typeChecker) command(cmd *parse.CommandNode, dot, piped reflect.Type, hasPiped bool) reflect.Type {
+	args := cmd.Args[1:]
+	extra := 0
+	if hasPiped {
+		extra = 1
+	}
+	switch n := cmd.Args[0].(type) {
+	case *parse.FieldNode:
+		return c.fields(n, dot, n.Ident, args, extra, dot)
+	case *parse.ChainNode:
+		return c.fields(n, c.arg(n.Node, dot), n.Field, args, extra, dot)
+	case *parse.VariableNode:
+		return c.fields(n, c.variable(n), n.Ident[1:], args, extra, dot)
+	case *parse.IdentifierNode:
+		return c.call(n, dot, args, piped, hasPiped)
+	}
+	return c.arg(cmd.Args[0], dot)
+}
+
+// arg returns the type of an operand, checking the accesses in it.
+func (c *typeChecker) arg(n parse.Node, dot reflect.Type) reflect.Type {
+	switch n := n.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.BoolNode:
+		return boolType
+	case *parse.StringNode:
+		return stringType
+	case *parse.NumberNode:
+		switch {
+		case n.IsInt:
+			return intType
+		case n.IsFloat:
+			return floatType
+		}
+	case *parse.FieldNode:
+		return c.fields(n, dot, n.Ident, nil, 0, dot)
+	case *parse.VariableNode:
+		return c.fields(n, c.variable(n), n.Ident[1:], nil, 0, dot)
+	case *parse.ChainNode:
+		return c.fields(n, c.arg(n.Node, dot), n.Field, nil, 0, dot)
+	case *parse.PipeNode:
+		return c.pipe(n, dot)
+	case *parse.IdentifierNode:
+		return c.call(n, dot, nil, nil, false)
+	}
+	return nil
+}
+
+func (c *typeChecker) variable(n *parse.VariableNode) reflect.Type {
+	for i := len(c.vars) - 1; i >= 0; i-- {
+		if c.vars[i].name == n.Ident[0] {
+			return c.vars[i].typ
+		}
+	}
+	return nil
+}
+
+// fields resolves the chain of names on t; the last one receives args
+// plus extra piped arguments.
+func (c *typeChecker) fields(n parse.Node, t reflect.Type, names []string, args []parse.Node, extra int, dot reflect.Type) reflect.Type {
+	for _, a := range args {
+		c.arg(a, dot)
+	}
+	for i, name := range names {
+		nargs := 0
+		if i == len(names)-1 {
+			nargs = len(args) + extra
+		}
+		if t = c.field(n, t, name, nargs); t == nil {
+			return nil
+		}
+	}
+	return t
+}
+
+// field returns the type of t.name called with nargs arguments, as
+// text/template resolves it: a method, then a struct field or map key.
+func (c *typeChecker) field(n parse.Node, t reflect.Type, name string, nargs int) reflect.Type {
+	if !known(t) {
+		return nil
+	}
+	if m, ok := method(t, name); ok {
+		c.arity(n, name, m.Type, 1, nargs)
+		return result(m.Type)
+	}
+	base := t
+	for base.Kind() == reflect.Ptr {
+		base = base.Elem()
+	}
+	switch base.Kind() {
+	case reflect.Struct:
+		f, ok := base.FieldByName(name)
+		if !ok {
+			break
+		}
+		if !f.IsExported() {
+			c.errorf(n, "%s is an unexported field of struct type %s", name, t)
+			return nil
+		}
+		// the At "field" of a loopOver result stands for its method
+		if nargs > 0 && !c.loops[base] {
+			c.errorf(n, "%s has arguments but cannot be invoked as function", name)
+		}
+		return f.Type
+	case reflect.Map:
+		if base.Key().Kind() != reflect.String {
+			return nil
+		}
+		if nargs > 0 {
+			c.errorf(n, "%s is not a method but has arguments", name)
+		}
+		return base.Elem()
+	}
+	c.errorf(n, "can't evaluate field %s in type %s", name, t)
+	return nil
+}
+
+// method finds an exported method of t or, for addressable values, *t.
+func method(t reflect.Type, name string) (reflect.Method, bool) {
+	if m, ok := t.MethodByName(name); ok && m.IsExported() {
+		return m, true
+	}
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface {
+		if m, ok := reflect.PointerTo(t).MethodByName(name); ok && m.IsExported() {
+			return m, true
+		}
+	}
+	return reflect.Method{}, false
+}
+
+// call checks a call of the function n and returns its result type.
+func (c *typeChecker) call(n *parse.IdentifierNode, dot reflect.Type, args []parse.Node, piped reflect.Type, hasPiped bool) reflect.Type {
+	types := make([]reflect.Type, 0, len(args)+1)
+	for _, a := range args {
+		types = append(types, c.arg(a, dot))
+	}
+	if hasPiped {
+		types = append(types, piped)
+	}
+	if r, ok := builtinArity[n.Ident]; ok {
+		if len(types) < r[0] || r[1] >= 0 && len(types) > r[1] {
+			want := strconv.Itoa(r[0])
+			if r[1] != r[0] {
+				want = "at least " + want
+				if r[1] >= 0 {
+					want = fmt.Sprintf("%d to %d", r[0], r[1])
+				}
+			}
+			c.errorf(n, "wrong number of args for %s: want %s got %d", n.Ident, want, len(types))
+			return nil
+		}
+		return builtinResult(n.Ident, types)
+	}
+	fn, ok := c.funcs[n.Ident]
+	if !ok {
+		return nil
+	}
+	ft := reflect.TypeOf(fn)
+	c.arity(n, n.Ident, ft, 0, len(types))
+	if n.Ident == "loopOver" && len(types) > 0 {
+		return c.loopType(n, types[0])
+	}
+	return result(ft)
+}
+
+// arity checks that the function or method type ft, whose first skip
+// inputs are not arguments (the receiver), accepts nargs arguments.
+func (c *typeChecker) arity(n parse.Node, name string, ft reflect.Type, skip, nargs int) {
+	in := ft.NumIn() - skip
+	switch {
+	case ft.IsVariadic() && nargs < in-1:
+		c.errorf(n, "wrong number of args for %s: want at least %d got %d", name, in-1, nargs)
+	case !ft.IsVariadic() && nargs != in:
+		c.errorf(n, "wrong number of args for %s: want %d got %d", name, in, nargs)
+	}
+}
+
+// result returns the value type of a function returning one value or a
+// value and an error.
+func result(ft reflect.Type) reflect.Type {
+	if ft.NumOut() == 0 {
+		return nil
+	}
+	return ft.Out(0)
+}
+
+func builtinResult(name string, args []reflect.Type) reflect.Type {
+	switch name {
+	case "not", "eq", "ne", "lt", "le", "gt", "ge":
+		return boolType
+	case "len":
+		return intType
+	case "print", "printf", "println", "html", "js", "urlquery":
+		return stringType
+	case "slice":
+		return args[0]
+	case "index":
+		t := args[0]
+		for range args[1:] {
+			if !known(t) {
+				return nil
+			}
+			for t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			switch t.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				t = t.Elem()
+			default:
+				return nil
+			}
+		}
+		return t
+	}
+	return nil
+}
+
+// loopType stands for the *loopState a @foreach iterates with, keeping
+// the key and element types of the collection: Keys and Values are typed
+// slices and At gives the $loop map.
+func (c *typeChecker) loopType(n parse.Node, coll reflect.Type) reflect.Type {
+	key, elem := c.rangeTypes(n, coll)
+	if key == nil {
+		key = anyType
+	}
+	if elem == nil {
+		elem = anyType
+	}
+	t := reflect.StructOf([]reflect.StructField{
+		{Name: "Keys", Type: reflect.SliceOf(key)},
+		{Name: "Values", Type: reflect.SliceOf(elem)},
+		{Name: "At", Type: reflect.TypeOf(map[string]interface{}{})},
+	})
+	c.loops[t] = true
+	return t
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type checkPost struct {
+	Title string
+	tags  []string
+}
+
+type checkUser struct {
+	Name  string
+	Posts []checkPost
+	Meta  map[string]interface{}
+}
+
+type checkPage struct {
+	User  *checkUser
+	Title string
+}
+
+func (u checkUser) Greeting(prefix string) string { return prefix + u.Name }
+
+func TestCheckTemplate(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "pages/ok.blade.tpl", `<h1>{{ $Title }}: {{ $User->Greeting('Hi ') }}</h1>
+@foreach($User->Posts as $i => $post){{ $loop->index }}{{ $post->Title | upper }}@endforeach
+{{ $User->Meta['x']->Anything }}`)
+	writeTempTemplate(t, tmp, "pages/bad.blade.tpl", `<h1>{{ $User->Nmae }}</h1>
+@foreach($User->Posts as $post)
+  {{ $post->Titel }}{{ $post->tags }}
+@endforeach
+{{ $User->Greeting() }}{{ truncate($Title) }}`)
+	be := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, Development: true})
+
+	if err := be.CheckTemplate("pages/ok.blade.tpl", reflect.TypeOf(checkPage{})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := be.CheckTemplate("pages/bad.blade.tpl", reflect.TypeOf(&checkPage{}))
+	if err == nil {
+		t.Fatal("expected type errors")
+	}
+	for _, want := range []string{
+		"pages/bad.blade.tpl:1:5: can't evaluate field Nmae in type *engine.checkUser",
+		"pages/bad.blade.tpl:3:3: can't evaluate field Titel in type engine.checkPost",
+		"pages/bad.blade.tpl:3:21: tags is an unexported field of struct type engine.checkPost",
+		"pages/bad.blade.tpl:5:1: wrong number of args for Greeting: want 1 got 0",
+		"pages/bad.blade.tpl:5:24: wrong number of args for truncate: want at least 2 got 1",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+	var terr *TemplateError
+	if !errors.As(err, &terr) || terr.Location.File != "pages/bad.blade.tpl" {
+		t.Errorf("expected *TemplateError values, got %v", err)
+	}
+
+	err = be.ValidateAllTemplatesAgainst(map[string]interface{}{
+		"pages/ok.blade.tpl":  checkPage{},
+		"pages/bad.blade.tpl": reflect.TypeOf(checkPage{}),
+	})
+	if err == nil || strings.Contains(err.Error(), "ok.blade.tpl") || !strings.Contains(err.Error(), "Nmae") {
+		t.Fatalf("ValidateAllTemplatesAgainst: %v", err)
+	}
+}
+
+func TestCheckTemplateBuiltinsWithoutArgs(t *testing.T) {
+	tmp := t.TempDir()
+	writeTempTemplate(t, tmp, "pages/p.blade.tpl", "{{ index() }}\n{{ slice }}")
+	be := NewBladeEngineWithConfig(BladeConfig{TemplatesDir: tmp, Development: true})
+	err := be.CheckTemplate("pages/p.blade.tpl", reflect.TypeOf(checkPage{}))
+	for _, want := range []string{
+		"pages/p.blade.tpl:1:1: wrong number of args for index: want at least 1 got 0",
+		"pages/p.blade.tpl:2:1: wrong number of args for slice: want 1 to 4 got 0",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
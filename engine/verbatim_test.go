@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerbatimSurvivesLayoutsAndEscaping(t *testing.T) {
+	files := map[string]string{
+		"layouts/app.blade.tpl": `<main>@yield('content')</main>`,
+		"pages/home.blade.tpl": `@extends('layouts/app.blade.tpl')
+@section('content')
+<h1>{{ $title }}</h1>
+<div id="app">@{{ message }} {{ $count }}</div>
+@verbatim
+<ul x-data="{ open: {{ open }} }"><li v-for="i in items">{{ i }}</li></ul>
+<script>var o = {a: {b: 1}}; var t = "{{ end }}{{define";</script>
+<style>@media print { p { color: red }}</style>
+@endverbatim
+<p>{{ $count }}{</p>
+@endsection`,
+	}
+	out := renderPage(t, files, "pages/home.blade.tpl", map[string]interface{}{"title": "Hi", "count": 2})
+	for _, want := range []string{
+		`<h1>Hi</h1>`,
+		`<div id="app">{{ message }} 2</div>`,
+		`<ul x-data="{ open: {{ open }} }"><li v-for="i in items">{{ i }}</li></ul>`,
+		`<script>var o = {a: {b: 1}}; var t = "{{ end }}{{define";</script>`,
+		`<style>@media print { p { color: red }}</style>`,
+		`<p>2{</p>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in output:\n%s", want, out)
+		}
+	}
+}
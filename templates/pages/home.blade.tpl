@@ -30,8 +30,8 @@ Overridden Inner
         @else
         <p>Welcome to our website!</p>
         @endif
-        <h3>Test @if in attribute</h3>
-        <p class="@if($user.IsAdmin) admin @else user @endif">This paragraph has a dynamic class based on user role.</p>
+        <h3>Dynamic class with @@class</h3>
+        <p @class(['admin' => $user.IsAdmin, 'user' => !$user.IsAdmin])>This paragraph has a dynamic class based on user role.</p>
         <div class="items">
             <h2>Our items</h2>
             <ul>